@@ -2,7 +2,9 @@ package color
 
 import (
 	"fmt"
-	"runtime"
+	"os"
+
+	"github.com/mcsteele8/common-cli-utils/internal/termcap"
 )
 
 const (
@@ -30,12 +32,16 @@ const (
 
 type color int
 
+// enabled is false when stdout cannot display colors, for example when it is
+// not a terminal or NO_COLOR is set.
+var enabled = termcap.DetectColorDepth(termcap.IsTerminal(os.Stdout.Fd()), os.Getenv) != termcap.ColorNone
+
 func (c color) Paint(text string) string {
 	return fmt.Sprintf("%s%s%s", c.toString(), text, Reset.toString())
 }
 
 func (c color) toString() string {
-	if runtime.GOOS == "windows" {
+	if !enabled {
 		return ""
 	}
 	switch c {
@@ -1,10 +1,16 @@
 package color
 
 import (
-	"runtime"
 	"testing"
 )
 
+// withColor sets whether colors are enabled for the duration of the test.
+func withColor(t *testing.T, on bool) {
+	previous := enabled
+	enabled = on
+	t.Cleanup(func() { enabled = previous })
+}
+
 func Test_color_toString(t *testing.T) {
 	tests := []struct {
 		name string
@@ -34,13 +40,7 @@ func Test_color_toString(t *testing.T) {
 		{"Invalid Color", color(999), "\033[0m"}, // Test for invalid input
 	}
 
-	// If on Windows, expected output should always be an empty string
-	if runtime.GOOS == "windows" {
-		for i := range tests {
-			tests[i].want = ""
-		}
-	}
-
+	withColor(t, true)
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if got := tt.c.toString(); got != tt.want {
@@ -48,6 +48,16 @@ func Test_color_toString(t *testing.T) {
 			}
 		})
 	}
+
+	// Without color support every color should be an empty string
+	withColor(t, false)
+	for _, tt := range tests {
+		t.Run(tt.name+" disabled", func(t *testing.T) {
+			if got := tt.c.toString(); got != "" {
+				t.Errorf("color.toString() = %v, want empty string", got)
+			}
+		})
+	}
 }
 
 func Test_color_Paint(t *testing.T) {
@@ -68,13 +78,7 @@ func Test_color_Paint(t *testing.T) {
 		{"Paint with Invalid Color", color(999), args{"Invalid"}, "\033[0mInvalid\033[0m"},
 	}
 
-	// If on Windows, the output should not include escape codes
-	if runtime.GOOS == "windows" {
-		for i := range tests {
-			tests[i].want = tests[i].args.text
-		}
-	}
-
+	withColor(t, true)
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if got := tt.c.Paint(tt.args.text); got != tt.want {
@@ -82,4 +86,14 @@ func Test_color_Paint(t *testing.T) {
 			}
 		})
 	}
+
+	// Without color support the output should not include escape codes
+	withColor(t, false)
+	for _, tt := range tests {
+		t.Run(tt.name+" disabled", func(t *testing.T) {
+			if got := tt.c.Paint(tt.args.text); got != tt.args.text {
+				t.Errorf("color.Paint() = %v, want %v", got, tt.args.text)
+			}
+		})
+	}
 }
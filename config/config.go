@@ -2,13 +2,16 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
 
+	"github.com/spf13/afero"
 	"github.com/spf13/viper"
 )
 
@@ -30,6 +33,23 @@ type ConfigOptions struct {
 	CfgFileType              string
 	CreateEmptyCfgIfNotFound bool
 	Verbose                  bool
+	// ExpandValues enables ${VAR}, ${key.path} and ${VAR:-fallback}
+	// interpolation of values read from the config file.
+	ExpandValues bool
+	// DotEnvFiles are .env files layered onto the environment, later files
+	// override earlier ones. Missing files are skipped.
+	DotEnvFiles []string
+	// DotEnvOverridesEnv gives dotenv values priority over real environment variables.
+	DotEnvOverridesEnv bool
+	// ExportDotEnv also sets the dotenv values in the process environment.
+	ExportDotEnv bool
+
+	// Viper is the instance values are read into, the global viper instance is used when nil.
+	Viper *viper.Viper
+	// LookupEnv replaces os.LookupEnv when reading env tags.
+	LookupEnv func(key string) (string, bool)
+	// Fs is the filesystem config and dotenv files are read from, the OS filesystem is used when nil.
+	Fs afero.Fs
 }
 
 var defaultCfgOptions = ConfigOptions{
@@ -39,6 +59,54 @@ var defaultCfgOptions = ConfigOptions{
 	CfgFileType:              "yaml",
 	CreateEmptyCfgIfNotFound: false,
 	Verbose:                  false,
+	ExpandValues:             false,
+	DotEnvFiles:              nil,
+	DotEnvOverridesEnv:       false,
+	ExportDotEnv:             false,
+	Viper:                    nil,
+	LookupEnv:                nil,
+	Fs:                       nil,
+}
+
+// loader holds the state used while reading values into a config struct.
+type loader struct {
+	v *viper.Viper
+	// file holds the config file as read, before any expansion, when
+	// ExpandValues is set.
+	file      *viper.Viper
+	fs        afero.Fs
+	opts      *ConfigOptions
+	lookupEnv func(key string) (string, bool)
+}
+
+// newLoader builds the loader for cfgOptions. The returned func must be called
+// once loading is done, it gives the global viper instance back its OS
+// filesystem when Fs was set without a Viper.
+func newLoader(cfgOptions *ConfigOptions) (*loader, func()) {
+	l := &loader{
+		v:         cfgOptions.Viper,
+		fs:        cfgOptions.Fs,
+		opts:      cfgOptions,
+		lookupEnv: cfgOptions.LookupEnv,
+	}
+
+	if l.v == nil {
+		l.v = viper.GetViper()
+	}
+	if l.lookupEnv == nil {
+		l.lookupEnv = os.LookupEnv
+	}
+
+	switch {
+	case l.fs == nil:
+		l.fs = afero.NewOsFs()
+	case cfgOptions.Viper == nil:
+		l.v.SetFs(l.fs)
+		return l, func() { l.v.SetFs(afero.NewOsFs()) }
+	default:
+		l.v.SetFs(l.fs)
+	}
+	return l, func() {}
 }
 
 /*
@@ -50,6 +118,13 @@ file:     Is the tag used to pull file values stored in ConfigOptions.CfgFilePat
 default:  Is the tag that will be used if no env or file value can be found
 mask:     Is the tag to mask the output of the value
 
+When ConfigOptions.ExpandValues is set, file values may reference environment
+variables or other file keys with ${HOME}, ${jira.url} or ${USER:-fallback}.
+
+ConfigOptions.DotEnvFiles adds .env files as a source for env tags. Real environment
+variables win unless ConfigOptions.DotEnvOverridesEnv is set, and os.Environ is only
+updated when ConfigOptions.ExportDotEnv is set.
+
 Example:
 
 	type cliConfig struct {
@@ -80,24 +155,37 @@ func NewConfig(configStruct any, cfgOptions *ConfigOptions) (any, error) {
 		return nil, fmt.Errorf("configStruct must be a pointer to a struct, got a pointer to %v", val.Elem().Kind())
 	}
 
+	l, done := newLoader(cfgOptions)
+	defer done()
+
 	if cfgOptions.CfgFilePath != "" {
-		viper.SetConfigFile(cfgOptions.CfgFilePath)
+		l.v.SetConfigFile(cfgOptions.CfgFilePath)
 	} else {
-		viper.SetConfigName(cfgOptions.CfgFileName)
-		viper.SetConfigType(cfgOptions.CfgFileType)
-		viper.AddConfigPath(cfgOptions.CfgDirectory)
+		l.v.SetConfigName(cfgOptions.CfgFileName)
+		l.v.SetConfigType(cfgOptions.CfgFileType)
+		l.v.AddConfigPath(cfgOptions.CfgDirectory)
 	}
 
 	cfgFileFound := true
-	if err := viper.ReadInConfig(); err != nil && (strings.Contains(err.Error(), "Not Found") || strings.Contains(err.Error(), "no such file or directory")) {
+	if err := l.v.ReadInConfig(); err != nil && (errors.Is(err, fs.ErrNotExist) || strings.Contains(err.Error(), "Not Found") || strings.Contains(err.Error(), "no such file or directory")) {
 		cfgFileFound = false
 	} else if err != nil && cfgOptions.Verbose {
 		fmt.Printf("error: %v\n", err)
+	} else if err == nil && cfgOptions.ExpandValues {
+		if err := l.readRawConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := l.loadDotEnv(); err != nil {
+		return nil, err
+	}
+	if err := l.readStruct(val.Elem()); err != nil {
+		return nil, err
 	}
 
-	readStruct(val.Elem(), cfgOptions.Verbose)
 	if !cfgFileFound && cfgOptions.CreateEmptyCfgIfNotFound {
-		if err := initEmptyCfg(cfgOptions); err != nil {
+		if err := l.initEmptyCfg(); err != nil {
 			return nil, fmt.Errorf("failed to init empty config: %w", err)
 		}
 	}
@@ -121,19 +209,19 @@ func FromCtx(ctx context.Context) any {
 	return ctx.Value(cfgCtxKey)
 }
 
-func initEmptyCfg(cfgOptions *ConfigOptions) error {
+func (l *loader) initEmptyCfg() error {
 	// create an empty config file with -rwxrwxrwx	0777  read, write, & execute for owner, group and others permissions
-	err := os.Mkdir(cfgOptions.CfgDirectory, 0777)
+	err := l.fs.Mkdir(l.opts.CfgDirectory, 0777)
 	if err != nil {
 		return fmt.Errorf("failed to create cfg directory %w", err)
 	}
 
-	err = os.WriteFile(cfgOptions.CfgFilePath, []byte(""), 0777)
+	err = afero.WriteFile(l.fs, l.opts.CfgFilePath, []byte(""), 0777)
 	if err != nil {
 		return fmt.Errorf("failed to create an empty cfg file %w", err)
 	}
 
-	err = viper.WriteConfig()
+	err = l.v.WriteConfig()
 	if err != nil {
 		return fmt.Errorf("failed to write values to new cfg %w", err)
 	}
@@ -143,67 +231,88 @@ func initEmptyCfg(cfgOptions *ConfigOptions) error {
 
 // readStruct is used to read the struct and will be recursively called
 // to read all child structs within cfg
-func readStruct(input reflect.Value, verbose bool) {
+func (l *loader) readStruct(input reflect.Value) error {
 	inputType := input.Type()
 
 	for i := 0; i < input.NumField(); i++ {
 		fieldValue := input.Field(i)
 		fieldName := inputType.Field(i).Name
+		tag := inputType.Field(i).Tag
 
+		var err error
 		switch fieldValue.Kind() {
 		case reflect.Struct:
-			readStruct(fieldValue, verbose)
+			err = l.readStruct(fieldValue)
 		case reflect.String:
-			setString(fieldValue, inputType.Field(i).Tag)
+			err = l.setString(fieldValue, tag)
 		case reflect.Bool:
-			setBool(fieldValue, inputType.Field(i).Tag)
+			err = l.setBool(fieldValue, tag)
 		case reflect.Int:
-			setInt(fieldValue, inputType.Field(i).Tag)
+			err = l.setInt(fieldValue, tag)
 		default:
 			log.Fatalf("Config type not supported yet: %s\n", fieldValue.Kind().String())
 		}
+		if err != nil {
+			return fmt.Errorf("failed to set %s: %w", fieldName, err)
+		}
 
-		if verbose && fieldValue.Kind() != reflect.Struct {
-			fmt.Printf("%s: %v\n", fieldName, getOutputValue(fieldValue, inputType.Field(i).Tag))
+		if l.opts.Verbose && fieldValue.Kind() != reflect.Struct {
+			fmt.Printf("%s: %v\n", fieldName, getOutputValue(fieldValue, tag))
 		}
 
 	}
 
+	return nil
 }
 
 func getOutputValue(fieldValue reflect.Value, tag reflect.StructTag) interface{} {
 	if tag.Get(cfgTagMask) == "true" {
-		return "*********"
+		return maskedValue
 	}
 	return fieldValue
 }
 
-func getTagValue(tag reflect.StructTag) string {
+func (l *loader) getTagValue(tag reflect.StructTag) (string, error) {
 	envTag := tag.Get(cfgTagEnv)
-	value := os.Getenv(envTag)
+	value, _ := l.lookupEnv(envTag)
 	if value == "" {
-		value = viper.GetString(tag.Get(cfgTagFile))
+		fileKey := tag.Get(cfgTagFile)
+		value, _ = l.fileValue(fileKey)
+		if value != "" && l.opts.ExpandValues {
+			expanded, err := l.expand(value, []string{strings.ToLower(fileKey)})
+			if err != nil {
+				return "", err
+			}
+			value = expanded
+		}
 	}
 
 	if value == "" {
 		value = tag.Get(cfgTagDefault)
 	}
-	return value
+	return value, nil
 }
 
-func setString(fieldValue reflect.Value, tag reflect.StructTag) {
-	value := getTagValue(tag)
+func (l *loader) setString(fieldValue reflect.Value, tag reflect.StructTag) error {
+	value, err := l.getTagValue(tag)
+	if err != nil {
+		return err
+	}
 
 	// Ensure the value is addressable
 	if fieldValue.CanSet() {
 		// Set the field value
 		fieldValue.SetString(value)
-		viper.Set(tag.Get(cfgTagFile), value)
+		l.v.Set(tag.Get(cfgTagFile), value)
 	}
+	return nil
 }
 
-func setInt(fieldValue reflect.Value, tag reflect.StructTag) {
-	value := getTagValue(tag)
+func (l *loader) setInt(fieldValue reflect.Value, tag reflect.StructTag) error {
+	value, err := l.getTagValue(tag)
+	if err != nil {
+		return err
+	}
 
 	intValue, err := strconv.Atoi(value)
 	if err != nil {
@@ -214,12 +323,16 @@ func setInt(fieldValue reflect.Value, tag reflect.StructTag) {
 	if fieldValue.CanSet() {
 		// Set the field value
 		fieldValue.SetInt(int64(intValue))
-		viper.Set(tag.Get(cfgTagFile), value)
+		l.v.Set(tag.Get(cfgTagFile), value)
 	}
+	return nil
 }
 
-func setBool(fieldValue reflect.Value, tag reflect.StructTag) {
-	value := getTagValue(tag)
+func (l *loader) setBool(fieldValue reflect.Value, tag reflect.StructTag) error {
+	value, err := l.getTagValue(tag)
+	if err != nil {
+		return err
+	}
 
 	boolValue := false
 	if value == "true" {
@@ -230,6 +343,7 @@ func setBool(fieldValue reflect.Value, tag reflect.StructTag) {
 	if fieldValue.CanSet() {
 		// Set the field value
 		fieldValue.SetBool(boolValue)
-		viper.Set(tag.Get(cfgTagFile), value)
+		l.v.Set(tag.Get(cfgTagFile), value)
 	}
+	return nil
 }
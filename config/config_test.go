@@ -2,8 +2,13 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -52,3 +57,224 @@ func TestNewConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestNewConfigExpandValues(t *testing.T) {
+	type cfg struct {
+		Home    string `file:"home_dir"`
+		Url     string `file:"jira.url"`
+		Issues  string `file:"jira.issues"`
+		Editor  string `file:"editor"`
+		Literal string `file:"literal"`
+	}
+
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := `home_dir: ${TEST_1234_HOME}/cli
+jira:
+  url: https://${TEST_1234_JIRA_HOST:-jira.example.com}
+  issues: ${jira.url}/issues
+editor: ${TEST_1234_UNSET_EDITOR:-vim}
+literal: $${TEST_1234_HOME}
+`
+	if err := os.WriteFile(cfgPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_1234_HOME", "/home/tester")
+
+	got, err := NewConfig(&cfg{}, &ConfigOptions{CfgFilePath: cfgPath, ExpandValues: true})
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+
+	want := &cfg{
+		Home:    "/home/tester/cli",
+		Url:     "https://jira.example.com",
+		Issues:  "https://jira.example.com/issues",
+		Editor:  "vim",
+		Literal: "${TEST_1234_HOME}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewConfig() = %+v, want %+v", got, want)
+	}
+	// viper returns the expanded values too
+	if got := viper.GetString("home_dir"); got != want.Home {
+		t.Errorf("viper.GetString(home_dir) = %q, want %q", got, want.Home)
+	}
+}
+
+func TestNewConfigExpandValuesTwice(t *testing.T) {
+	type cfg struct {
+		Literal string `file:"twice_literal"`
+		Ref     string `file:"twice_ref"`
+	}
+
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := "twice_literal: $${TEST_1234_HOME}\ntwice_ref: ${twice_literal}/ref\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_1234_HOME", "/home/tester")
+
+	// a second load on the same viper must not expand the escape again
+	for i := 0; i < 2; i++ {
+		got, err := NewConfig(&cfg{}, &ConfigOptions{CfgFilePath: cfgPath, ExpandValues: true})
+		if err != nil {
+			t.Fatalf("NewConfig() error = %v", err)
+		}
+		want := &cfg{Literal: "${TEST_1234_HOME}", Ref: "${TEST_1234_HOME}/ref"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("NewConfig() #%d = %+v, want %+v", i+1, got, want)
+		}
+		if got := viper.GetString("twice_literal"); got != "${TEST_1234_HOME}" {
+			t.Errorf("viper.GetString(twice_literal) #%d = %q, want %q", i+1, got, "${TEST_1234_HOME}")
+		}
+	}
+}
+
+func TestNewConfigExpandValuesCycle(t *testing.T) {
+	type cfg struct {
+		A string `file:"cycle_a"`
+		B string `file:"cycle_b"`
+	}
+
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := "cycle_a: ${cycle_b}\ncycle_b: ${cycle_a}\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewConfig(&cfg{}, &ConfigOptions{CfgFilePath: cfgPath, ExpandValues: true})
+	if err == nil || !strings.Contains(err.Error(), "cycle detected") {
+		t.Errorf("NewConfig() error = %v, want cycle error", err)
+	}
+}
+
+func TestDump(t *testing.T) {
+	type jira struct {
+		Url      string `env:"CLI_JIRA_URL" file:"jira.url"`
+		Password string `env:"CLI_JIRA_PASSWORD" file:"jira.password" mask:"true"`
+	}
+	cfg := &struct {
+		Jira    jira
+		Retries int    `file:"retries"`
+		Debug   bool   `env:"CLI_DEBUG" file:"debug"`
+		Motd    string `env:"CLI_MOTD"`
+		token   string `env:"CLI_TOKEN" file:"token"`
+	}{
+		Jira:    jira{Url: "https://jira.example.com", Password: "secret"},
+		Retries: 3,
+		Debug:   true,
+		Motd:    "it's $HOME",
+		token:   "internal",
+	}
+
+	tests := []struct {
+		format DumpFormat
+		want   string
+	}{
+		{FormatYAML, "Motd: it's $HOME\ndebug: true\njira:\n  password: '*********'\n  url: https://jira.example.com\nretries: 3\n"},
+		{FormatJSON, "{\n  \"Motd\": \"it's $HOME\",\n  \"debug\": true,\n  \"jira\": {\n    \"password\": \"*********\",\n    \"url\": \"https://jira.example.com\"\n  },\n  \"retries\": 3\n}\n"},
+		{FormatTOML, "Motd = \"it's $HOME\"\ndebug = true\nretries = 3\n\n[jira]\npassword = '*********'\nurl = 'https://jira.example.com'\n"},
+		{FormatEnv, "export CLI_JIRA_URL='https://jira.example.com'\nexport CLI_JIRA_PASSWORD='*********'\nexport CLI_DEBUG='true'\nexport CLI_MOTD='it'\\''s $HOME'\n"},
+		{FormatDotEnv, "CLI_JIRA_URL=https://jira.example.com\nCLI_JIRA_PASSWORD=*********\nCLI_DEBUG=true\nCLI_MOTD=\"it's \\$HOME\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			got, err := Dump(cfg, tt.format)
+			if err != nil {
+				t.Fatalf("Dump() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Dump() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Dump(cfg, "xml"); err == nil {
+		t.Errorf("Dump() with unsupported format should return an error")
+	}
+}
+
+func TestNewConfigDotEnv(t *testing.T) {
+	type cfg struct {
+		User    string `env:"TEST_1234_DOTENV_USER"`
+		Token   string `env:"TEST_1234_DOTENV_TOKEN"`
+		Message string `env:"TEST_1234_DOTENV_MESSAGE"`
+	}
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, ".env")
+	local := filepath.Join(dir, ".env.local")
+	baseContent := `# shared values
+export TEST_1234_DOTENV_USER=dotenv-user # inline comment
+TEST_1234_DOTENV_TOKEN='base-token'
+TEST_1234_DOTENV_MESSAGE="hello\nworld"
+`
+	if err := os.WriteFile(base, []byte(baseContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(local, []byte("TEST_1234_DOTENV_TOKEN=local-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_1234_DOTENV_USER", "env-user")
+
+	tests := []struct {
+		name string
+		opts *ConfigOptions
+		want *cfg
+	}{
+		{
+			name: "env_wins_by_default",
+			opts: &ConfigOptions{DotEnvFiles: []string{base, local, filepath.Join(dir, "missing.env")}},
+			want: &cfg{User: "env-user", Token: "local-token", Message: "hello\nworld"},
+		},
+		{
+			name: "dotenv_overrides_env",
+			opts: &ConfigOptions{DotEnvFiles: []string{base}, DotEnvOverridesEnv: true},
+			want: &cfg{User: "dotenv-user", Token: "base-token", Message: "hello\nworld"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewConfig(&cfg{}, tt.opts)
+			if err != nil {
+				t.Fatalf("NewConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewConfig() = %+v, want %+v", got, tt.want)
+			}
+			if _, ok := os.LookupEnv("TEST_1234_DOTENV_TOKEN"); ok {
+				t.Errorf("dotenv values should not be exported without ExportDotEnv")
+			}
+		})
+	}
+}
+
+func TestNewConfigFsKeepsGlobalViperFs(t *testing.T) {
+	type cfg struct {
+		Name string `file:"fs_name"`
+	}
+
+	memFs := afero.NewMemMapFs()
+	if err := afero.WriteFile(memFs, "/etc/cli/config.yaml", []byte("fs_name: from-memory\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewConfig(&cfg{}, &ConfigOptions{CfgFilePath: "/etc/cli/config.yaml", Fs: memFs})
+	if err != nil || got.(*cfg).Name != "from-memory" {
+		t.Fatalf("NewConfig() with Fs = %+v, error = %v", got, err)
+	}
+
+	// the global viper reads from the OS filesystem again afterwards
+	type diskCfg struct {
+		Name string `file:"fs_disk_name"`
+	}
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte("fs_disk_name: from-disk\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err = NewConfig(&diskCfg{}, &ConfigOptions{CfgFilePath: cfgPath})
+	if err != nil || got.(*diskCfg).Name != "from-disk" {
+		t.Errorf("NewConfig() after Fs = %+v, error = %v", got, err)
+	}
+}
@@ -0,0 +1,127 @@
+// Package configtest helps test code built on config.NewConfig without touching
+// the process environment, the global viper instance or the real filesystem.
+package configtest
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mcsteele8/common-cli-utils/config"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "rewrite configtest golden files with the current output")
+
+/*
+Loader reads config structs in isolation.
+
+Env:       Fake environment used for env tags and ${VAR} references, the real environment is never read
+Files:     In-memory files keyed by path, used for config and dotenv files
+Defaults:  Fixed file values keyed by file tag, used when Files does not provide the key
+
+Example:
+
+	loader := &configtest.Loader{
+		Env:   map[string]string{"CLI_JIRA_USERNAME": "tester"},
+		Files: map[string]string{"/cfg/config.yaml": "jira_password: secret"},
+	}
+
+	cfg := &cliConfig{}
+	loader.MustLoad(t, cfg, &config.ConfigOptions{CfgFilePath: "/cfg/config.yaml"})
+*/
+type Loader struct {
+	Env      map[string]string
+	Files    map[string]string
+	Defaults map[string]any
+}
+
+// Load populates configStruct the same way config.NewConfig does, using only the
+// loader's env, files and defaults. Any Viper, LookupEnv or Fs set on cfgOptions
+// is replaced. When cfgOptions is nil and Files holds a single file, that file is
+// used as the config file.
+func (l *Loader) Load(configStruct any, cfgOptions *config.ConfigOptions) (any, error) {
+	opts := config.ConfigOptions{CfgFileName: "config", CfgFileType: "yaml"}
+	if cfgOptions != nil {
+		opts = *cfgOptions
+	} else if len(l.Files) == 1 {
+		for path := range l.Files {
+			opts.CfgFilePath = path
+		}
+	}
+
+	fs := afero.NewMemMapFs()
+	for path, content := range l.Files {
+		if err := afero.WriteFile(fs, path, []byte(content), 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	v := viper.New()
+	for key, value := range l.Defaults {
+		v.SetDefault(key, value)
+	}
+
+	opts.Viper = v
+	opts.Fs = fs
+	opts.LookupEnv = func(key string) (string, bool) {
+		value, ok := l.Env[key]
+		return value, ok
+	}
+	// keep dotenv values out of the real environment
+	opts.ExportDotEnv = false
+
+	return config.NewConfig(configStruct, &opts)
+}
+
+// MustLoad calls Load and fails the test on error.
+func (l *Loader) MustLoad(t testing.TB, configStruct any, cfgOptions *config.ConfigOptions) any {
+	t.Helper()
+
+	cfg, err := l.Load(configStruct, cfgOptions)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	return cfg
+}
+
+// AssertGolden compares got with testdata/<name>.golden. Run the tests with
+// -update-golden to write the current output to the golden file instead.
+func AssertGolden(t testing.TB, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("failed to update golden file %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file %s, run with -update-golden to create it: %v", path, err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("output does not match %s, run with -update-golden to accept it\n--- got ---\n%s\n--- want ---\n%s", path, got, want)
+	}
+}
+
+// AssertDump renders configStruct with config.Dump and compares it with
+// testdata/<name>.golden, useful for pinning sample config output.
+func AssertDump(t testing.TB, name string, configStruct any, format config.DumpFormat) {
+	t.Helper()
+
+	out, err := config.Dump(configStruct, format)
+	if err != nil {
+		t.Fatalf("failed to dump config: %v", err)
+	}
+	AssertGolden(t, name, out)
+}
@@ -0,0 +1,69 @@
+package configtest
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/mcsteele8/common-cli-utils/config"
+)
+
+type testConfig struct {
+	Username string `env:"CONFIGTEST_USERNAME" file:"username" default:"empty"`
+	Password string `env:"CONFIGTEST_PASSWORD" file:"password" mask:"true"`
+	Region   string `env:"CONFIGTEST_REGION" file:"region" default:"us-east-1"`
+	Retries  int    `file:"retries" default:"1"`
+}
+
+func TestLoaderLoad(t *testing.T) {
+	os.Setenv("CONFIGTEST_USERNAME", "from-real-env")
+	defer os.Unsetenv("CONFIGTEST_USERNAME")
+
+	tests := []struct {
+		name   string
+		loader *Loader
+		opts   *config.ConfigOptions
+		want   *testConfig
+	}{
+		{
+			name: "env_file_and_defaults",
+			loader: &Loader{
+				Env:      map[string]string{"CONFIGTEST_PASSWORD": "secret"},
+				Files:    map[string]string{"/cfg/config.yaml": "username: file-user\n"},
+				Defaults: map[string]any{"retries": 5},
+			},
+			want: &testConfig{Username: "file-user", Password: "secret", Region: "us-east-1", Retries: 5},
+		},
+		{
+			name: "dotenv_from_memory",
+			loader: &Loader{
+				Files: map[string]string{
+					"/cfg/config.yaml": "region: ${CONFIGTEST_REGION_OVERRIDE}\n",
+					"/repo/.env":       "CONFIGTEST_REGION_OVERRIDE=eu-west-1\n",
+				},
+			},
+			opts: &config.ConfigOptions{
+				CfgFilePath:  "/cfg/config.yaml",
+				DotEnvFiles:  []string{"/repo/.env"},
+				ExpandValues: true,
+			},
+			want: &testConfig{Username: "empty", Region: "eu-west-1", Retries: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.loader.MustLoad(t, &testConfig{}, tt.opts)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssertDump(t *testing.T) {
+	loader := &Loader{Env: map[string]string{"CONFIGTEST_PASSWORD": "secret"}}
+	cfg := loader.MustLoad(t, &testConfig{}, nil)
+
+	AssertDump(t, "sample_yaml", cfg, config.FormatYAML)
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// loadDotEnv reads ConfigOptions.DotEnvFiles in order, later files overriding
+// earlier ones, and layers the result onto the loader's env lookup.
+// Missing files are skipped so a .env can stay optional.
+func (l *loader) loadDotEnv() error {
+	if len(l.opts.DotEnvFiles) == 0 {
+		return nil
+	}
+
+	values := map[string]string{}
+	for _, path := range l.opts.DotEnvFiles {
+		data, err := afero.ReadFile(l.fs, path)
+		if errors.Is(err, fs.ErrNotExist) {
+			if l.opts.Verbose {
+				fmt.Printf("dotenv file not found: %s\n", path)
+			}
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to read dotenv file %s: %w", path, err)
+		}
+
+		parsed, err := parseDotEnv(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse dotenv file %s: %w", path, err)
+		}
+		for k, v := range parsed {
+			values[k] = v
+		}
+	}
+
+	if l.opts.ExportDotEnv {
+		for k, v := range values {
+			if _, ok := os.LookupEnv(k); ok && !l.opts.DotEnvOverridesEnv {
+				continue
+			}
+			if err := os.Setenv(k, v); err != nil {
+				return fmt.Errorf("failed to export dotenv value %s: %w", k, err)
+			}
+		}
+	}
+
+	envLookup := l.lookupEnv
+	l.lookupEnv = func(key string) (string, bool) {
+		dotEnvValue, inDotEnv := values[key]
+		if inDotEnv && l.opts.DotEnvOverridesEnv {
+			return dotEnvValue, true
+		}
+		if value, ok := envLookup(key); ok {
+			return value, true
+		}
+		return dotEnvValue, inDotEnv
+	}
+
+	return nil
+}
+
+// parseDotEnv parses KEY=value lines. Blank lines, # comments and a leading
+// "export " are ignored. Double quoted values support \n, \r, \t, \", \\ and \$
+// escapes, single quoted values are taken literally and unquoted values end at
+// the first " #".
+func parseDotEnv(data []byte) (map[string]string, error) {
+	values := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNum)
+		}
+
+		value, err := parseDotEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		values[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func parseDotEnvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch raw[0] {
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", errors.New("unterminated single quoted value")
+		}
+		return raw[1 : end+1], nil
+	case '"':
+		var out strings.Builder
+		for i := 1; i < len(raw); i++ {
+			switch c := raw[i]; c {
+			case '"':
+				return out.String(), nil
+			case '\\':
+				if i+1 >= len(raw) {
+					return "", errors.New("unterminated double quoted value")
+				}
+				i++
+				switch raw[i] {
+				case 'n':
+					out.WriteByte('\n')
+				case 'r':
+					out.WriteByte('\r')
+				case 't':
+					out.WriteByte('\t')
+				default:
+					out.WriteByte(raw[i])
+				}
+			default:
+				out.WriteByte(c)
+			}
+		}
+		return "", errors.New("unterminated double quoted value")
+	default:
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = raw[:i]
+		}
+		return strings.TrimSpace(raw), nil
+	}
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// DumpFormat is the output format used by Dump.
+type DumpFormat string
+
+const (
+	FormatYAML   DumpFormat = "yaml"
+	FormatJSON   DumpFormat = "json"
+	FormatTOML   DumpFormat = "toml"
+	FormatEnv    DumpFormat = "env"
+	FormatDotEnv DumpFormat = "dotenv"
+
+	maskedValue = "*********"
+)
+
+// dumpField is a single resolved config value.
+type dumpField struct {
+	name    string
+	envKey  string
+	fileKey string
+	value   any
+}
+
+/*
+Dump renders the resolved values of a config struct populated by NewConfig.
+Fields tagged with mask:"true" are always rendered as "*********".
+
+yaml, json and toml:  keyed by the file tag, dotted keys become nested objects
+env:                  "export VAR='value'" lines keyed by the env tag, suitable for eval
+dotenv:               "VAR=value" lines keyed by the env tag, suitable for a .env file
+
+Fields without a file tag are keyed by their field name, fields without an env
+tag are left out of the env and dotenv formats.
+
+Example:
+
+	out, err := config.Dump(cfg, config.FormatEnv)
+	if err != nil {
+		log.Fatalf("failed to dump config: %v", err)
+	}
+	fmt.Print(string(out))
+*/
+func Dump(configStruct any, format DumpFormat) ([]byte, error) {
+	val := reflect.Indirect(reflect.ValueOf(configStruct))
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("configStruct must be a struct or a pointer to a struct, got %v", val.Kind())
+	}
+
+	fields := collectFields(val, nil)
+
+	switch format {
+	case FormatYAML, FormatJSON, FormatTOML:
+		tree, err := buildTree(fields)
+		if err != nil {
+			return nil, err
+		}
+		return marshalTree(tree, format)
+	case FormatEnv:
+		return dumpEnv(fields, "export ", shellQuote), nil
+	case FormatDotEnv:
+		return dumpEnv(fields, "", dotEnvQuote), nil
+	default:
+		return nil, fmt.Errorf("unsupported dump format %q", format)
+	}
+}
+
+// collectFields walks the struct the same way readStruct does and returns every
+// supported field in declaration order.
+func collectFields(input reflect.Value, fields []dumpField) []dumpField {
+	inputType := input.Type()
+
+	for i := 0; i < input.NumField(); i++ {
+		fieldValue := input.Field(i)
+		field := inputType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		switch fieldValue.Kind() {
+		case reflect.Struct:
+			fields = collectFields(fieldValue, fields)
+			continue
+		case reflect.String, reflect.Bool, reflect.Int:
+		default:
+			continue
+		}
+
+		var value any = maskedValue
+		if field.Tag.Get(cfgTagMask) != "true" {
+			value = fieldValue.Interface()
+		}
+
+		fields = append(fields, dumpField{
+			name:    field.Name,
+			envKey:  field.Tag.Get(cfgTagEnv),
+			fileKey: field.Tag.Get(cfgTagFile),
+			value:   value,
+		})
+	}
+
+	return fields
+}
+
+// buildTree nests values under their dotted file keys, "jira.url" becomes {"jira": {"url": ...}}.
+func buildTree(fields []dumpField) (map[string]any, error) {
+	tree := map[string]any{}
+
+	for _, f := range fields {
+		key := f.fileKey
+		if key == "" {
+			key = f.name
+		}
+
+		parts := strings.Split(key, ".")
+		node := tree
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part]
+			if !ok {
+				child = map[string]any{}
+				node[part] = child
+			}
+
+			childMap, ok := child.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("config key %q conflicts with value at %q", key, part)
+			}
+			node = childMap
+		}
+
+		leaf := parts[len(parts)-1]
+		if _, ok := node[leaf]; ok {
+			return nil, fmt.Errorf("config key %q is defined more than once", key)
+		}
+		node[leaf] = f.value
+	}
+
+	return tree, nil
+}
+
+func marshalTree(tree map[string]any, format DumpFormat) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		out, err := json.MarshalIndent(tree, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal config as json: %w", err)
+		}
+		return append(out, '\n'), nil
+	case FormatTOML:
+		out, err := toml.Marshal(tree)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal config as toml: %w", err)
+		}
+		return out, nil
+	default:
+		buf := bytes.Buffer{}
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(tree); err != nil {
+			return nil, fmt.Errorf("failed to marshal config as yaml: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+func dumpEnv(fields []dumpField, prefix string, quote func(string) string) []byte {
+	buf := bytes.Buffer{}
+	for _, f := range fields {
+		if f.envKey == "" {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s%s=%s\n", prefix, f.envKey, quote(fmt.Sprint(f.value)))
+	}
+	return buf.Bytes()
+}
+
+// shellQuote wraps value in single quotes so it is safe to eval in a POSIX shell.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// dotEnvQuote only quotes values that need it so simple .env files stay readable.
+func dotEnvQuote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n\r\"'\\$#=") {
+		return value
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`)
+	return `"` + replacer.Replace(value) + `"`
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// expand replaces ${VAR}, ${key.path} and ${VAR:-fallback} references within value.
+// Environment variables take priority over file keys so ${HOME} always resolves
+// to the user's home directory. A literal "$" can be written as "$$".
+//
+// stack holds the file keys currently being expanded and is used to detect
+// values that reference each other.
+func (l *loader) expand(value string, stack []string) (string, error) {
+	var out strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c != '$' || i+1 >= len(value) {
+			out.WriteByte(c)
+			continue
+		}
+
+		switch value[i+1] {
+		case '$':
+			out.WriteByte('$')
+			i++
+		case '{':
+			end := matchingBrace(value, i+1)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated reference in config value %q", value)
+			}
+
+			resolved, err := l.resolveRef(value[i+2:end], stack)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(resolved)
+			i = end
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	return out.String(), nil
+}
+
+// resolveRef resolves the body of a single ${...} reference.
+func (l *loader) resolveRef(ref string, stack []string) (string, error) {
+	name, fallback, hasFallback := strings.Cut(ref, ":-")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("empty reference ${%s} in config value", ref)
+	}
+
+	if value, ok := l.lookupEnv(name); ok && value != "" {
+		return value, nil
+	}
+
+	key := strings.ToLower(name)
+	if raw, ok := l.fileValue(key); ok {
+		for _, k := range stack {
+			if k == key {
+				return "", fmt.Errorf("config value cycle detected: %s -> %s", strings.Join(stack, " -> "), key)
+			}
+		}
+
+		value, err := l.expand(raw, append(stack, key))
+		if err != nil {
+			return "", err
+		}
+		if value != "" {
+			return value, nil
+		}
+	}
+
+	if hasFallback {
+		return l.expand(fallback, stack)
+	}
+
+	return "", nil
+}
+
+// readRawConfig reads the config file viper found a second time, into l.file.
+// Resolved values are written back to viper, where they override the file, so
+// expanding what viper returns would expand values from an earlier load twice.
+func (l *loader) readRawConfig() error {
+	l.file = viper.New()
+	l.file.SetFs(l.fs)
+	l.file.SetConfigFile(l.v.ConfigFileUsed())
+	if l.opts.CfgFilePath == "" {
+		l.file.SetConfigType(l.opts.CfgFileType)
+	}
+	if err := l.file.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", l.v.ConfigFileUsed(), err)
+	}
+	return nil
+}
+
+// fileValue returns the value of key as written in the config file, falling
+// back to viper for keys the file does not set.
+func (l *loader) fileValue(key string) (string, bool) {
+	if l.file != nil && l.file.IsSet(key) {
+		return l.file.GetString(key), true
+	}
+	return l.v.GetString(key), l.v.IsSet(key)
+}
+
+// matchingBrace returns the index of the brace closing the one at open,
+// taking nested ${...} references into account, or -1 if there is none.
+func matchingBrace(value string, open int) int {
+	depth := 0
+	for i := open; i < len(value); i++ {
+		switch value[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
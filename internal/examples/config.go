@@ -57,3 +57,18 @@ func exampleConfigWithCtx() {
 	fmt.Println("Jira Username From Ctx:", cfg.JiraUsername)
 	fmt.Println("Jira Password From Ctx:", cfg.JiraPassword)
 }
+
+func exampleConfigDump() {
+	cfg := &cliConfig{}
+
+	if _, err := config.NewConfig(cfg, nil); err != nil {
+		log.Fatalf("failed to set config values: %v", err)
+	}
+
+	out, err := config.Dump(cfg, config.FormatEnv)
+	if err != nil {
+		log.Fatalf("failed to dump config: %v", err)
+	}
+
+	fmt.Print(string(out))
+}
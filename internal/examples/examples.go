@@ -3,6 +3,7 @@ package examples
 func RunExamples() {
 	exampleConfig()
 	exampleConfigWithCtx()
+	exampleConfigDump()
 	exampleTerminal()
 	exampleColor()
 	exampleConformationPrompt()
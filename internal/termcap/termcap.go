@@ -0,0 +1,158 @@
+// Package termcap detects what the terminal the program runs in supports. It is
+// shared by the color, spinner and terminal packages, terminal.Info exposes it.
+package termcap
+
+import (
+	"os"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ColorDepth is how many colors the terminal can display.
+type ColorDepth int
+
+const (
+	ColorNone ColorDepth = iota
+	Color16
+	Color256
+	ColorTrueColor
+)
+
+func (d ColorDepth) String() string {
+	switch d {
+	case Color16:
+		return "16"
+	case Color256:
+		return "256"
+	case ColorTrueColor:
+		return "truecolor"
+	default:
+		return "none"
+	}
+}
+
+// Info describes the terminal attached to the program.
+type Info struct {
+	// StdinTTY, StdoutTTY and StderrTTY report which standard streams are
+	// attached to a terminal.
+	StdinTTY  bool
+	StdoutTTY bool
+	StderrTTY bool
+	// Width and Height are the terminal size in cells, 0 when no standard
+	// stream is a terminal.
+	Width  int
+	Height int
+	// ColorDepth is the color support of stdout, see DetectColorDepth.
+	ColorDepth ColorDepth
+	// CI is set when running in a continuous integration system.
+	CI bool
+	// Unicode is set when the terminal can display non-ASCII characters.
+	Unicode bool
+}
+
+// ciVars are set by continuous integration systems.
+var ciVars = []string{"CI", "GITHUB_ACTIONS", "GITLAB_CI", "BUILDKITE", "CIRCLECI", "JENKINS_URL", "TF_BUILD", "TEAMCITY_VERSION"}
+
+// Detect inspects the standard streams and the environment.
+func Detect() Info {
+	info := Info{
+		StdinTTY:  IsTerminal(os.Stdin.Fd()),
+		StdoutTTY: IsTerminal(os.Stdout.Fd()),
+		StderrTTY: IsTerminal(os.Stderr.Fd()),
+		CI:        DetectCI(os.Getenv),
+		Unicode:   DetectUnicode(os.Getenv),
+	}
+	info.Width, info.Height = Size()
+	info.ColorDepth = DetectColorDepth(info.StdoutTTY, os.Getenv)
+	return info
+}
+
+// IsTerminal reports whether the file descriptor fd is attached to a terminal.
+func IsTerminal(fd uintptr) bool {
+	return term.IsTerminal(int(fd))
+}
+
+// Size returns the terminal size from the first standard stream attached to a
+// terminal, 0, 0 when there is none.
+func Size() (width, height int) {
+	for _, f := range []*os.File{os.Stdout, os.Stderr, os.Stdin} {
+		if w, h, err := term.GetSize(int(f.Fd())); err == nil {
+			return w, h
+		}
+	}
+	return 0, 0
+}
+
+// DetectColorDepth works out the color support of a stream from the
+// environment. NO_COLOR turns color off and FORCE_COLOR (0-3) overrides the
+// detection, otherwise streams that are not a terminal get no color.
+func DetectColorDepth(isTTY bool, getenv func(string) string) ColorDepth {
+	if getenv("NO_COLOR") != "" {
+		return ColorNone
+	}
+	switch getenv("FORCE_COLOR") {
+	case "":
+	case "0", "false":
+		return ColorNone
+	case "2":
+		return Color256
+	case "3":
+		return ColorTrueColor
+	default:
+		return Color16
+	}
+
+	termEnv := getenv("TERM")
+	switch {
+	case !isTTY, termEnv == "dumb":
+		return ColorNone
+	case runtime.GOOS == "windows" && !DetectWindowsTerminal(getenv):
+		// the legacy console does not interpret escape sequences
+		return ColorNone
+	}
+
+	colorTerm := strings.ToLower(getenv("COLORTERM"))
+	switch {
+	case colorTerm == "truecolor" || colorTerm == "24bit",
+		strings.Contains(termEnv, "truecolor") || strings.Contains(termEnv, "direct"),
+		runtime.GOOS == "windows":
+		return ColorTrueColor
+	case strings.Contains(termEnv, "256color"):
+		return Color256
+	}
+	return Color16
+}
+
+// DetectCI reports whether a continuous integration system is running us.
+func DetectCI(getenv func(string) string) bool {
+	for _, name := range ciVars {
+		if value := getenv(name); value != "" && value != "false" {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectWindowsTerminal reports whether we run in Windows Terminal on windows,
+// which unlike the legacy console handles escape sequences itself.
+func DetectWindowsTerminal(getenv func(string) string) bool {
+	return runtime.GOOS == "windows" && getenv("WT_SESSION") != ""
+}
+
+// DetectUnicode reports whether the terminal can display non-ASCII characters,
+// based on the locale, or on Windows Terminal being used on windows.
+func DetectUnicode(getenv func(string) string) bool {
+	if runtime.GOOS == "windows" {
+		return DetectWindowsTerminal(getenv) || getenv("TERM_PROGRAM") == "vscode"
+	}
+
+	// the first locale variable set decides, like in setlocale(3)
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if value := strings.ToLower(getenv(name)); value != "" {
+			return strings.Contains(value, "utf-8") || strings.Contains(value, "utf8")
+		}
+	}
+	return getenv("TERM_PROGRAM") != ""
+}
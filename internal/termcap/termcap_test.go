@@ -0,0 +1,91 @@
+//go:build !windows
+
+package termcap
+
+import "testing"
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string {
+		return vars[name]
+	}
+}
+
+func TestDetectColorDepth(t *testing.T) {
+	tests := []struct {
+		name  string
+		isTTY bool
+		env   map[string]string
+		want  ColorDepth
+	}{
+		{"not a tty", false, map[string]string{"TERM": "xterm-256color"}, ColorNone},
+		{"basic", true, map[string]string{"TERM": "xterm"}, Color16},
+		{"256 colors", true, map[string]string{"TERM": "xterm-256color"}, Color256},
+		{"truecolor", true, map[string]string{"TERM": "xterm-256color", "COLORTERM": "truecolor"}, ColorTrueColor},
+		{"24bit", true, map[string]string{"COLORTERM": "24bit"}, ColorTrueColor},
+		{"dumb", true, map[string]string{"TERM": "dumb"}, ColorNone},
+		{"no color", true, map[string]string{"TERM": "xterm-256color", "NO_COLOR": "1"}, ColorNone},
+		{"forced without tty", false, map[string]string{"FORCE_COLOR": "1"}, Color16},
+		{"forced 256", false, map[string]string{"FORCE_COLOR": "2"}, Color256},
+		{"forced off", true, map[string]string{"TERM": "xterm", "FORCE_COLOR": "0"}, ColorNone},
+		{"no color beats force", true, map[string]string{"FORCE_COLOR": "3", "NO_COLOR": "1"}, ColorNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectColorDepth(tt.isTTY, env(tt.env)); got != tt.want {
+				t.Errorf("DetectColorDepth() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectCI(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want bool
+	}{
+		{"none", map[string]string{}, false},
+		{"ci", map[string]string{"CI": "true"}, true},
+		{"ci false", map[string]string{"CI": "false"}, false},
+		{"github actions", map[string]string{"GITHUB_ACTIONS": "true"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectCI(env(tt.env)); got != tt.want {
+				t.Errorf("DetectCI() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectWindowsTerminal(t *testing.T) {
+	// WT_SESSION can leak into WSL or an SSH session, it only counts on windows
+	if DetectWindowsTerminal(env(map[string]string{"WT_SESSION": "1"})) {
+		t.Errorf("DetectWindowsTerminal() = true outside windows")
+	}
+}
+
+func TestDetectUnicode(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want bool
+	}{
+		{"utf-8 lang", map[string]string{"LANG": "en_US.UTF-8"}, true},
+		{"utf8 lang", map[string]string{"LANG": "C.utf8"}, true},
+		{"c locale", map[string]string{"LANG": "C"}, false},
+		{"lc_all wins", map[string]string{"LC_ALL": "C", "LANG": "en_US.UTF-8"}, false},
+		{"no locale", map[string]string{}, false},
+		{"terminal program", map[string]string{"TERM_PROGRAM": "iTerm.app"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectUnicode(env(tt.env)); got != tt.want {
+				t.Errorf("DetectUnicode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -12,10 +12,9 @@ import (
 	"unicode/utf8"
 
 	cilUtilsColor "github.com/mcsteele8/common-cli-utils/color"
+	"github.com/mcsteele8/common-cli-utils/internal/termcap"
 
 	"github.com/fatih/color"
-
-	"golang.org/x/term"
 )
 
 // Spinner struct to hold the provided options.
@@ -39,14 +38,21 @@ type Spinner struct {
 
 const (
 	spinningDotsCharsetNum = 14
+	asciiCharsetNum        = 9
 	spinInterval           = time.Millisecond * 100
 )
 
 var (
-	state = New(CharSets[spinningDotsCharsetNum], spinInterval)
+	state = New(defaultCharSet(), spinInterval)
 
 	// returns true if the OS is windows and the WT_SESSION env variable is set.
-	isWindowsTerminalOnWindows = len(os.Getenv("WT_SESSION")) > 0 && runtime.GOOS == "windows"
+	isWindowsTerminalOnWindows = termcap.DetectWindowsTerminal(os.Getenv)
+
+	// running holds every started spinner for StopAll.
+	running = struct {
+		sync.Mutex
+		spinners map[*Spinner]struct{}
+	}{spinners: map[*Spinner]struct{}{}}
 )
 
 // Start begins the spinner.
@@ -79,10 +85,19 @@ func SetFinalMsg(message string) {
 	state.FinalMSG = "\t" + cilUtilsColor.Yellow.Paint(message) + "\n"
 }
 
+// defaultCharSet returns the spinning dots, or a plain ASCII spinner when the
+// terminal cannot display unicode.
+func defaultCharSet() []string {
+	if !termcap.DetectUnicode(os.Getenv) {
+		return CharSets[asciiCharsetNum]
+	}
+	return CharSets[spinningDotsCharsetNum]
+}
+
 // NewDefault provides a pointer to an instance of Spinner with our
 // default charset and spin interval, along with any options provided
 func NewDefault(options ...Option) *Spinner {
-	s := New(CharSets[spinningDotsCharsetNum], spinInterval)
+	s := New(defaultCharSet(), spinInterval)
 	for _, opt := range options {
 		opt(s)
 	}
@@ -186,6 +201,9 @@ func (s *Spinner) Start() {
 		fmt.Fprint(s.Writer, "\033[?25l")
 	}
 	s.active = true
+	running.Lock()
+	running.spinners[s] = struct{}{}
+	running.Unlock()
 	s.mu.Unlock()
 
 	go func() {
@@ -218,7 +236,7 @@ func (s *Spinner) Start() {
 					} else {
 						outColor = fmt.Sprintf("\r%s%s %s ", s.Prefix, s.color(s.chars[i]), s.Suffix)
 					}
-					maxWidth, _, _ := term.GetSize(0)
+					maxWidth, _ := termcap.Size()
 					if maxWidth != 0 && len(outColor) > maxWidth {
 						outColor = outColor[:maxWidth]
 					}
@@ -258,6 +276,25 @@ func (s *Spinner) Stop() {
 			}
 		}
 		s.stopChan <- struct{}{}
+
+		running.Lock()
+		delete(running.spinners, s)
+		running.Unlock()
+	}
+}
+
+// StopAll stops every running spinner, for example to restore the cursor
+// before the program exits.
+func StopAll() {
+	running.Lock()
+	spinners := make([]*Spinner, 0, len(running.spinners))
+	for s := range running.spinners {
+		spinners = append(spinners, s)
+	}
+	running.Unlock()
+
+	for _, s := range spinners {
+		s.Stop()
 	}
 }
 
@@ -0,0 +1,106 @@
+package terminal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+/*
+CaptureLimit caps how much of a command's stdout and stderr is kept in its
+Result. The first Head and the last Tail bytes of each stream are kept and the
+bytes in between are replaced by a "... [N bytes truncated] ..." line. Output
+streamed with ShowOutput, Stdout, Stderr or the line callbacks is never cut.
+
+Example:
+
+	opt := &terminal.RunCmdOptions{
+		ShowOutput:   true,
+		CaptureLimit: &terminal.CaptureLimit{Head: 64 << 10, Tail: 1 << 20},
+	}
+	res, err := terminal.Exec(ctx, terminal.Command("make", "build"), opt)
+*/
+type CaptureLimit struct {
+	// Head is how many bytes from the start of each stream are kept.
+	Head int
+	// Tail is how many bytes from the end of each stream are kept.
+	Tail int
+}
+
+// capture collects the output of a command.
+type capture interface {
+	io.Writer
+	Bytes() []byte
+}
+
+// newCapture returns an unbounded buffer, or one keeping only the head and
+// tail of the output when opt.CaptureLimit is set.
+func newCapture(opt *RunCmdOptions) capture {
+	if opt.CaptureLimit == nil {
+		return &bytes.Buffer{}
+	}
+	return &limitedBuffer{limit: *opt.CaptureLimit}
+}
+
+// truncated reports whether any of the captures dropped output.
+func truncated(captures ...capture) bool {
+	for _, c := range captures {
+		if b, ok := c.(*limitedBuffer); ok && b.dropped > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedBuffer keeps the first limit.Head bytes written to it and the last
+// limit.Tail bytes in a ring buffer, counting the bytes dropped in between.
+type limitedBuffer struct {
+	limit   CaptureLimit
+	head    []byte
+	tail    []byte
+	pos     int
+	dropped int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+
+	if room := b.limit.Head - len(b.head); room > 0 {
+		k := min(room, len(p))
+		b.head = append(b.head, p[:k]...)
+		p = p[k:]
+	}
+
+	if b.limit.Tail <= 0 {
+		b.dropped += int64(len(p))
+		return n, nil
+	}
+
+	for len(p) > 0 {
+		if len(b.tail) < b.limit.Tail {
+			k := min(b.limit.Tail-len(b.tail), len(p))
+			b.tail = append(b.tail, p[:k]...)
+			p = p[k:]
+			continue
+		}
+
+		// the ring is full, overwrite the oldest bytes
+		k := min(len(b.tail)-b.pos, len(p))
+		copy(b.tail[b.pos:], p[:k])
+		b.pos = (b.pos + k) % len(b.tail)
+		b.dropped += int64(k)
+		p = p[k:]
+	}
+
+	return n, nil
+}
+
+// Bytes returns the kept output with a marker where bytes were dropped.
+func (b *limitedBuffer) Bytes() []byte {
+	out := bytes.Clone(b.head)
+	if b.dropped > 0 {
+		out = fmt.Appendf(out, "\n... [%d bytes truncated] ...\n", b.dropped)
+	}
+	out = append(out, b.tail[b.pos:]...)
+	return append(out, b.tail[:b.pos]...)
+}
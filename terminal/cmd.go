@@ -0,0 +1,236 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const defaultShell = "/bin/sh"
+
+// strictPrelude stops a script at the first failing command, unset variable
+// or failing pipeline stage. pipefail is only set by shells that support it.
+const strictPrelude = "set -eu; (set -o pipefail) 2>/dev/null && set -o pipefail\n"
+
+/*
+Cmd describes a program to run. Build one with Command, which passes its
+arguments to the program untouched, or with ShellCommand when the script
+genuinely needs shell features like pipes, globs or variable expansion.
+
+Scripts that need a particular shell set Shell, and values are best passed as
+ScriptArgs rather than pasted into the script, so they never need quoting.
+
+Example:
+
+	c := &terminal.Cmd{
+		Shell:      "bash",
+		Script:     deployScript,
+		ScriptArgs: []string{env, version},
+		Strict:     true,
+		InFile:     true,
+	}
+	res, err := terminal.Exec(ctx, c, nil)
+*/
+type Cmd struct {
+	// Name is the program to run, looked up in PATH when it has no separators.
+	Name string
+	// Args are passed to Name as is, without any shell processing.
+	Args []string
+	// Script is run by a shell when set, Name and Args are ignored.
+	Script string
+	// Shell runs Script instead of /bin/sh, for example "bash" or "zsh".
+	// RunCmdOptions.Shell sets it for every script.
+	Shell string
+	// ScriptArgs are passed to Script as the positional parameters $1, $2, ...
+	ScriptArgs []string
+	// Strict runs Script with "set -euo pipefail" so it stops at the first
+	// failing command.
+	Strict bool
+	// InFile writes Script to a temporary file that the shell runs, instead of
+	// passing it with -c. The file is removed once the command has exited.
+	InFile bool
+}
+
+// Command returns a Cmd that runs name with args without going through a shell,
+// so user input in args never needs quoting.
+func Command(name string, args ...string) *Cmd {
+	return &Cmd{
+		Name: name,
+		Args: args,
+	}
+}
+
+// ShellCommand returns a Cmd that runs script with /bin/sh -c. Quote any user
+// input placed in script with Quote.
+func ShellCommand(script string) *Cmd {
+	return &Cmd{
+		Script: script,
+	}
+}
+
+// String returns the command as it would be typed into a shell.
+func (c *Cmd) String() string {
+	switch {
+	case c.Script == "":
+		return QuoteArgs(append([]string{c.Name}, c.Args...)...)
+	case c.Shell == "" && len(c.ScriptArgs) == 0:
+		return c.Script
+	}
+
+	shell := c.Shell
+	if shell == "" {
+		shell = "sh"
+	}
+	return QuoteArgs(append([]string{shell, "-c", c.Script, shell}, c.ScriptArgs...)...)
+}
+
+// RunCmd runs c like RunCommandContext runs a script and returns its stdout.
+func RunCmd(ctx context.Context, c *Cmd, opt *RunCmdOptions) ([]byte, error) {
+	res, err := Exec(ctx, c, opt)
+	return res.Stdout, err
+}
+
+// Exec runs c and returns a Result describing the finished command. The
+// Result is returned even when the command fails, in which case err is an
+// *ExitError.
+func Exec(ctx context.Context, c *Cmd, opt *RunCmdOptions) (*Result, error) {
+	if opt == nil {
+		opt = &RunCmdOptions{}
+	}
+
+	start := time.Now()
+	var res *Result
+	var err error
+	switch {
+	case isDryRun(opt):
+		res = runDry(c, opt)
+	case opt.Retry != nil:
+		res, err = opt.Retry.run(ctx, c, opt)
+	default:
+		res, err = execOnce(ctx, c, opt)
+	}
+
+	redactResult(redactorFor(opt), res, err)
+	record(opt, res, err, start)
+	return res, err
+}
+
+// execOnce makes a single attempt at running c, opt.CtxTimeout applies to
+// each attempt.
+func execOnce(ctx context.Context, c *Cmd, opt *RunCmdOptions) (*Result, error) {
+	var cancel context.CancelFunc
+	if opt.CtxTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opt.CtxTimeout)
+		defer cancel()
+	}
+
+	res, err := executorFor(opt).Execute(ctx, c, opt)
+	if res == nil {
+		// callers read the result even when the attempt failed
+		res = &Result{Command: c.String()}
+		if err != nil {
+			res.ExitCode = -1
+		}
+	}
+	return res, err
+}
+
+// execCmd builds the exec.Cmd running c, scripts run with shell unless c.Shell
+// is set. The returned func removes the script file of InFile scripts and must
+// be called once the command has exited.
+func (c *Cmd) execCmd(ctx context.Context, shell string) (*exec.Cmd, func()) {
+	if c.Script == "" {
+		return exec.CommandContext(ctx, c.Name, c.Args...), func() {}
+	}
+
+	argv, cleanup, err := c.shellArgv(shell)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	if err != nil {
+		// Start returns Err without running anything
+		cmd.Err = err
+	}
+	return cmd, cleanup
+}
+
+// shellArgv returns the argv running script c with shell unless c.Shell is
+// set. The returned func removes the script file of InFile scripts, it is
+// safe to call when err is not nil.
+func (c *Cmd) shellArgv(shell string) ([]string, func(), error) {
+	if c.Shell != "" {
+		shell = c.Shell
+	}
+	if shell == "" {
+		shell = defaultShell
+	}
+	script := c.Script
+	if c.Strict {
+		script = strictPrelude + script
+	}
+
+	if !c.InFile {
+		argv := []string{shell, "-c", script}
+		if len(c.ScriptArgs) > 0 {
+			// the first argument after the script becomes $0
+			argv = append(append(argv, shell), c.ScriptArgs...)
+		}
+		return argv, func() {}, nil
+	}
+
+	path, err := writeScript(script)
+	argv := append([]string{shell, path}, c.ScriptArgs...)
+	if err != nil {
+		return argv, func() {}, err
+	}
+	return argv, func() {
+		os.Remove(path)
+	}, nil
+}
+
+// writeScript writes script to a new temporary file and returns its path.
+func writeScript(script string) (string, error) {
+	f, err := os.CreateTemp("", "script-*.sh")
+	if err != nil {
+		return "", fmt.Errorf("failed to create script file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(script); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write script file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// Quote returns s quoted for a POSIX shell. Strings made only of characters
+// the shell treats literally are returned unchanged.
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, needsQuoting) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// QuoteArgs quotes each argument with Quote and joins them with spaces.
+func QuoteArgs(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = Quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func needsQuoting(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	case strings.ContainsRune("_-+=@%:,./", r):
+		return false
+	}
+	return true
+}
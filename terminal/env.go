@@ -0,0 +1,122 @@
+package terminal
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// buildEnv returns the environment a command runs with. The base is the
+// current environment, or only the variables named in opt.InheritEnv when
+// opt.CleanEnv or opt.InheritEnv is set. opt.Env is layered on top, then
+// opt.UnsetEnv is removed. Duplicate keys are collapsed with the last value
+// winning, keeping the position of the first occurrence.
+func buildEnv(opt *RunCmdOptions) []string {
+	base := os.Environ()
+	if usesCleanEnv(opt) {
+		base = inheritedEnv(opt.InheritEnv)
+	}
+
+	keys := []string{}
+	values := map[string]string{}
+	for _, kv := range append(base, opt.Env...) {
+		key, value, _ := strings.Cut(kv, "=")
+		if _, seen := values[key]; !seen {
+			keys = append(keys, key)
+		}
+		values[key] = value
+	}
+
+	for _, key := range opt.UnsetEnv {
+		delete(values, key)
+	}
+
+	env := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if value, ok := values[key]; ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	return env
+}
+
+func usesCleanEnv(opt *RunCmdOptions) bool {
+	return opt.CleanEnv || len(opt.InheritEnv) > 0
+}
+
+// inheritedEnv returns the current environment variables matching names. A
+// name ending in "*" matches every variable with that prefix.
+func inheritedEnv(names []string) []string {
+	env := []string{}
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		for _, name := range names {
+			if key == name || (strings.HasSuffix(name, "*") && strings.HasPrefix(key, strings.TrimSuffix(name, "*"))) {
+				env = append(env, kv)
+				break
+			}
+		}
+	}
+	return env
+}
+
+// envForDisplay hides the value of every KEY=value entry as KEY=<set> unless
+// opt.ShowEnvValues is set. Prefixes like "+" and entries without a value
+// are kept as they are.
+func envForDisplay(opt *RunCmdOptions, entries []string) []string {
+	if opt.ShowEnvValues || len(entries) == 0 {
+		return entries
+	}
+
+	shown := make([]string, len(entries))
+	for i, entry := range entries {
+		shown[i] = entry
+		if key, _, ok := strings.Cut(entry, "="); ok {
+			shown[i] = key + "=<set>"
+		}
+	}
+	return shown
+}
+
+// envDiff describes how the command's environment differs from the current
+// one: "+KEY=value" for new variables, "~KEY=value" for changed ones and
+// "-KEY" for removed ones. A clean environment is listed in full.
+func envDiff(opt *RunCmdOptions) []string {
+	env := buildEnv(opt)
+	diff := []string{}
+
+	if usesCleanEnv(opt) {
+		for _, kv := range env {
+			diff = append(diff, "+"+kv)
+		}
+		sort.Strings(diff)
+		return append([]string{"(clean environment)"}, diff...)
+	}
+
+	current := map[string]string{}
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		current[key] = value
+	}
+
+	remaining := map[string]bool{}
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		remaining[key] = true
+		old, ok := current[key]
+		switch {
+		case !ok:
+			diff = append(diff, "+"+kv)
+		case old != value:
+			diff = append(diff, "~"+kv)
+		}
+	}
+	for key := range current {
+		if !remaining[key] {
+			diff = append(diff, "-"+key)
+		}
+	}
+
+	sort.Strings(diff)
+	return diff
+}
@@ -0,0 +1,81 @@
+package terminal
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+)
+
+// Executor runs a single attempt of a command. The package functions handle
+// timeouts, retries, dry-run and recording and hand the actual run to an
+// Executor, so replacing it with a fake makes code built on this package
+// testable without spawning processes. See the terminaltest package.
+//
+// Execute should return a Result even when it fails, a nil Result is
+// replaced with one holding only the command and exit code -1.
+type Executor interface {
+	Execute(ctx context.Context, c *Cmd, opt *RunCmdOptions) (*Result, error)
+}
+
+// PathLooker is implemented by Executors that decide which programs are
+// installed. Which, Check and Require use it instead of searching PATH.
+type PathLooker interface {
+	LookPath(name string) (string, error)
+}
+
+// OSExecutor runs commands as real processes.
+type OSExecutor struct{}
+
+// LookPath searches PATH for name.
+func (OSExecutor) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+func (OSExecutor) Execute(ctx context.Context, c *Cmd, opt *RunCmdOptions) (*Result, error) {
+	if opt.RunInPTY {
+		return runPTY(ctx, c, opt)
+	}
+	if opt.Interactive {
+		return runInteractive(ctx, c, opt)
+	}
+	return runCaptured(ctx, c, opt)
+}
+
+var (
+	executorMu      sync.RWMutex
+	defaultExecutor Executor = OSExecutor{}
+)
+
+// SetExecutor replaces the Executor used by every command without
+// RunCmdOptions.Executor set and returns the previous one. Passing nil
+// restores OSExecutor.
+func SetExecutor(e Executor) Executor {
+	if e == nil {
+		e = OSExecutor{}
+	}
+
+	executorMu.Lock()
+	defer executorMu.Unlock()
+	previous := defaultExecutor
+	defaultExecutor = e
+	return previous
+}
+
+// lookPath finds name with the package-wide Executor when it is a
+// PathLooker, or in PATH.
+func lookPath(name string) (string, error) {
+	if looker, ok := executorFor(&RunCmdOptions{}).(PathLooker); ok {
+		return looker.LookPath(name)
+	}
+	return exec.LookPath(name)
+}
+
+func executorFor(opt *RunCmdOptions) Executor {
+	if opt.Executor != nil {
+		return opt.Executor
+	}
+
+	executorMu.RLock()
+	defer executorMu.RUnlock()
+	return defaultExecutor
+}
@@ -0,0 +1,36 @@
+package terminal
+
+import "github.com/mcsteele8/common-cli-utils/internal/termcap"
+
+// TermInfo describes the terminal attached to the program, see Info.
+type TermInfo = termcap.Info
+
+// ColorDepth is how many colors the terminal can display.
+type ColorDepth = termcap.ColorDepth
+
+const (
+	ColorNone      = termcap.ColorNone
+	Color16        = termcap.Color16
+	Color256       = termcap.Color256
+	ColorTrueColor = termcap.ColorTrueColor
+)
+
+/*
+Info reports which standard streams are attached to a terminal, its size,
+the color depth of stdout, whether we run in CI and whether the terminal can
+display unicode. It is detected on every call so Width and Height follow
+resizes.
+
+Color depth honors NO_COLOR and FORCE_COLOR (0-3) and otherwise comes from
+TERM and COLORTERM; stdout that is not a terminal gets no color.
+
+Example:
+
+	info := terminal.Info()
+	if info.CI || !info.StdoutTTY {
+		// no spinners or progress bars in logs
+	}
+*/
+func Info() TermInfo {
+	return termcap.Detect()
+}
@@ -0,0 +1,217 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mcsteele8/common-cli-utils/spinner"
+	"github.com/mcsteele8/common-cli-utils/terminal/screen"
+)
+
+// interruptGracePeriod is how long child processes get to exit after SIGTERM
+// once we have been interrupted.
+const interruptGracePeriod = 2 * time.Second
+
+var (
+	interruptMu        sync.Mutex
+	interruptHooks     []*func()
+	interruptInstalled bool
+)
+
+// children tracks every running child process so an interrupt can stop them.
+var children = struct {
+	sync.Mutex
+	cmds map[*exec.Cmd]chan struct{}
+}{cmds: map[*exec.Cmd]chan struct{}{}}
+
+/*
+OnInterrupt registers fn to run when the program receives SIGINT (Ctrl-C) or
+SIGTERM and returns a func removing it again. The first call installs the
+signal handler, which then:
+
+ 1. stops every running spinner
+ 2. stops every child process started by this package, SIGTERM to its process
+    group followed by SIGKILL after 2 seconds
+ 3. runs the registered hooks, the most recently registered first
+ 4. shows the cursor again and exits with 130 for SIGINT, 143 for SIGTERM
+
+A second signal while this runs exits straight away.
+
+Example:
+
+	remove := terminal.OnInterrupt(func() {
+		os.RemoveAll(workDir)
+	})
+	defer remove()
+*/
+func OnInterrupt(fn func()) (remove func()) {
+	interruptMu.Lock()
+	if !interruptInstalled {
+		interruptInstalled = true
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go handleInterrupt(signals)
+	}
+	interruptMu.Unlock()
+
+	return addInterruptHook(fn)
+}
+
+// addInterruptHook registers fn like OnInterrupt without installing the
+// signal handler, fn only runs if something else installed it.
+func addInterruptHook(fn func()) (remove func()) {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+
+	hook := &fn
+	interruptHooks = append(interruptHooks, hook)
+
+	return func() {
+		interruptMu.Lock()
+		defer interruptMu.Unlock()
+		for i, h := range interruptHooks {
+			if h == hook {
+				interruptHooks = append(interruptHooks[:i], interruptHooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// restoreOnSignal runs restore if SIGINT or SIGTERM arrives before the
+// returned stop func is called. It does not install the OnInterrupt handler:
+// restore is also registered as a hook for when that handler exits the
+// program, and without it the signal is raised again once restore has run so
+// it still ends the program.
+func restoreOnSignal(restore func()) (stop func()) {
+	removeHook := addInterruptHook(restore)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			restore()
+			signal.Stop(signals)
+			interruptMu.Lock()
+			installed := interruptInstalled
+			interruptMu.Unlock()
+			if !installed {
+				if p, err := os.FindProcess(os.Getpid()); err == nil {
+					p.Signal(sig)
+				}
+			}
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+		removeHook()
+	}
+}
+
+func handleInterrupt(signals chan os.Signal) {
+	sig := <-signals
+	code := exitCode(sig)
+
+	go func() {
+		// a second Ctrl-C skips the cleanup
+		<-signals
+		os.Exit(code)
+	}()
+
+	cleanupInterrupted()
+	os.Exit(code)
+}
+
+// cleanupInterrupted runs everything OnInterrupt promises before exiting.
+func cleanupInterrupted() {
+	spinner.StopAll()
+	stopChildren(interruptGracePeriod)
+
+	interruptMu.Lock()
+	hooks := append([]*func(){}, interruptHooks...)
+	interruptMu.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		runHook(*hooks[i])
+	}
+
+	screen.New(os.Stdout).ShowCursor()
+}
+
+// runHook runs fn, a panicking hook does not stop the ones after it.
+func runHook(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "interrupt hook panicked: %v\n", r)
+		}
+	}()
+	fn()
+}
+
+// exitCode returns the shell convention exit code for being killed by sig.
+func exitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+// track adds a started cmd to the running children, the returned func must be
+// called once it has exited.
+func track(cmd *exec.Cmd) (untrack func()) {
+	done := make(chan struct{})
+	children.Lock()
+	children.cmds[cmd] = done
+	children.Unlock()
+
+	return func() {
+		children.Lock()
+		delete(children.cmds, cmd)
+		children.Unlock()
+		close(done)
+	}
+}
+
+// stopChildren sends SIGTERM to every running child and SIGKILL to the ones
+// still running after grace.
+func stopChildren(grace time.Duration) {
+	children.Lock()
+	running := make(map[*exec.Cmd]chan struct{}, len(children.cmds))
+	for cmd, done := range children.cmds {
+		running[cmd] = done
+	}
+	children.Unlock()
+
+	for cmd := range running {
+		terminateProcess(cmd)
+	}
+
+	deadline := time.After(grace)
+	for _, done := range running {
+		select {
+		case <-done:
+		case <-deadline:
+			killRunning(running)
+			return
+		}
+	}
+}
+
+func killRunning(running map[*exec.Cmd]chan struct{}) {
+	for cmd, done := range running {
+		select {
+		case <-done:
+		default:
+			killProcess(cmd)
+		}
+	}
+}
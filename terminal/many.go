@@ -0,0 +1,204 @@
+package terminal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mcsteele8/common-cli-utils/color"
+)
+
+const defaultConcurrency = 4
+
+// errFailFast cancels the remaining tasks once one fails with FailFast set.
+var errFailFast = errors.New("another task failed")
+
+// Task is a single command run by RunMany.
+type Task struct {
+	// Name identifies the task in prefixed output and the summary.
+	Name string
+	Cmd  *Cmd
+	// Opt holds options for this task only, it may be nil.
+	Opt *RunCmdOptions
+}
+
+type RunManyOptions struct {
+	// Concurrency is the maximum number of tasks running at once. Defaults to 4.
+	Concurrency int
+	// FailFast cancels running tasks and skips the rest once a task fails.
+	FailFast bool
+	// ShowOutput streams every task's output to the terminal prefixed with "[name] ".
+	ShowOutput bool
+	// PrefixColor colors the "[name] " prefix, for example color.Cyan.Paint.
+	PrefixColor func(string) string
+	// ShowSummary prints the summary table once all tasks have finished.
+	ShowSummary bool
+}
+
+// TaskResult is the outcome of a single task. With RunManyOptions.FailFast set
+// a task that had not started when another task failed is Skipped and has a
+// nil Result, one that was running is Cancelled. Neither counts as failed.
+type TaskResult struct {
+	Name string
+	*Result
+	Err       error
+	Skipped   bool
+	Cancelled bool
+}
+
+// TaskResults holds the results of RunMany in the order the tasks were given.
+type TaskResults []*TaskResult
+
+/*
+RunMany runs tasks with at most opt.Concurrency of them at a time and waits for
+all of them to finish. The returned error joins the errors of every failed task,
+so errors.As still finds each *ExitError.
+
+Example:
+
+	tasks := []terminal.Task{}
+	for _, dir := range []string{"api", "web", "worker"} {
+		tasks = append(tasks, terminal.Task{
+			Name: dir,
+			Cmd:  terminal.Command("go", "test", "./..."),
+			Opt:  &terminal.RunCmdOptions{Cwd: dir},
+		})
+	}
+
+	results, err := terminal.RunMany(ctx, tasks, &terminal.RunManyOptions{ShowOutput: true, ShowSummary: true})
+*/
+func RunMany(ctx context.Context, tasks []Task, opt *RunManyOptions) (TaskResults, error) {
+	if opt == nil {
+		opt = &RunManyOptions{}
+	}
+
+	for i, task := range tasks {
+		if task.Cmd == nil {
+			return nil, fmt.Errorf("task %d (%s) has no command", i+1, task.Name)
+		}
+	}
+
+	concurrency := opt.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	results := make(TaskResults, len(tasks))
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+
+	for i, task := range tasks {
+		results[i] = &TaskResult{Name: task.Name}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Skipped = true
+			continue
+		}
+		if ctx.Err() != nil {
+			<-sem
+			results[i].Skipped = true
+			continue
+		}
+
+		wg.Add(1)
+		go func(tr *TaskResult, task Task) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			tr.Result, tr.Err = Exec(ctx, task.Cmd, taskOptions(task, opt))
+			switch {
+			case tr.Err == nil:
+			case errors.Is(tr.Err, context.Canceled) && errors.Is(context.Cause(ctx), errFailFast):
+				tr.Cancelled = true
+			case opt.FailFast:
+				cancel(errFailFast)
+			}
+		}(results[i], task)
+	}
+	wg.Wait()
+
+	if opt.ShowSummary {
+		fmt.Fprint(os.Stdout, results.Summary())
+	}
+
+	return results, results.Err()
+}
+
+// taskOptions applies the RunMany options on top of the task's own options.
+func taskOptions(task Task, opt *RunManyOptions) *RunCmdOptions {
+	taskOpt := RunCmdOptions{}
+	if task.Opt != nil {
+		taskOpt = *task.Opt
+	}
+
+	if opt.ShowOutput {
+		taskOpt.ShowOutput = true
+	}
+	if taskOpt.Prefix == "" && task.Name != "" {
+		taskOpt.Prefix = "[" + task.Name + "] "
+		taskOpt.PrefixColor = opt.PrefixColor
+	}
+
+	return &taskOpt
+}
+
+// Failed returns the tasks that ran and failed, not counting the ones
+// cancelled because another task failed.
+func (r TaskResults) Failed() TaskResults {
+	failed := TaskResults{}
+	for _, tr := range r {
+		if tr.Err != nil && !tr.Cancelled {
+			failed = append(failed, tr)
+		}
+	}
+	return failed
+}
+
+// Err joins the errors of every failed task, nil when none failed.
+func (r TaskResults) Err() error {
+	errs := []error{}
+	for _, tr := range r.Failed() {
+		errs = append(errs, fmt.Errorf("%s: %w", tr.Name, tr.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// Summary renders a table of every task's status, exit code and duration.
+func (r TaskResults) Summary() string {
+	sb := strings.Builder{}
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tSTATUS\tEXIT CODE\tDURATION")
+
+	for _, tr := range r {
+		status, exitCode, duration := color.Green.Paint("ok"), "0", "-"
+		switch {
+		case tr.Skipped:
+			status, exitCode = color.Gray.Paint("skipped"), "-"
+		case tr.Cancelled:
+			status = color.Gray.Paint("cancelled")
+		case tr.Err != nil:
+			status = color.Red.Paint("failed")
+		}
+		if tr.Result != nil {
+			exitCode = fmt.Sprint(tr.ExitCode)
+			duration = tr.Duration.Round(time.Millisecond).String()
+			if tr.TimedOut {
+				status = color.Red.Paint("timed out")
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", tr.Name, status, exitCode, duration)
+	}
+
+	w.Flush()
+	return sb.String()
+}
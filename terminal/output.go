@@ -0,0 +1,207 @@
+package terminal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// LineWriter calls a function with every complete line written to it. The
+// trailing newline (and carriage return) is stripped from each line.
+type LineWriter struct {
+	fn  func(line string)
+	buf []byte
+}
+
+// NewLineWriter returns a LineWriter calling fn for every line.
+func NewLineWriter(fn func(line string)) *LineWriter {
+	return &LineWriter{fn: fn}
+}
+
+func (l *LineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.fn(string(bytes.TrimSuffix(l.buf[:i], []byte("\r"))))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush calls fn with any trailing text that did not end in a newline.
+func (l *LineWriter) Flush() error {
+	if len(l.buf) > 0 {
+		l.fn(string(bytes.TrimSuffix(l.buf, []byte("\r"))))
+		l.buf = nil
+	}
+	return nil
+}
+
+// PrefixWriter writes every line to the underlying writer with a prefix, for
+// example "[build] ", so output from several commands can be told apart.
+type PrefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+// NewPrefixWriter returns a PrefixWriter writing to w. paint is optional and
+// colors the prefix, for example color.Cyan.Paint.
+func NewPrefixWriter(w io.Writer, prefix string, paint func(string) string) *PrefixWriter {
+	if paint != nil {
+		prefix = paint(prefix)
+	}
+	return &PrefixWriter{w: w, prefix: prefix}
+}
+
+func (p *PrefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := io.WriteString(p.w, p.prefix+string(p.buf[:i+1])); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes any trailing text that did not end in a newline.
+func (p *PrefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(p.w, p.prefix+string(p.buf)+"\n")
+	p.buf = nil
+	return err
+}
+
+// flusher is implemented by writers holding a partial line.
+type flusher interface {
+	Flush() error
+}
+
+// printRunning echoes the command about to run with opt.Prefix in front, so
+// it can be told apart from other commands sharing the terminal.
+func printRunning(opt *RunCmdOptions, label, command string) {
+	prefix := opt.Prefix
+	if prefix != "" && opt.PrefixColor != nil {
+		prefix = opt.PrefixColor(prefix)
+	}
+	fmt.Printf("%s%s: %s\n", prefix, label, redactorFor(opt).Redact(command))
+}
+
+// lockedWriter serializes writes to w with a mutex shared between a command's
+// stdout and stderr, so callbacks and writers never run concurrently.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// streams holds the writers a command's stdout and stderr are copied to.
+type streams struct {
+	stdout io.Writer
+	stderr io.Writer
+	// stderrSink is stderr before redaction, for callers that feed it from
+	// several goroutines and need a redacting writer per source.
+	stderrSink io.Writer
+	mu         *sync.Mutex
+	flushers   []flusher
+	redactor   *Redactor
+	redacting  []flusher
+}
+
+// newStreams combines the capture writers with the terminal (when
+// opt.ShowOutput is set), opt.Stdout/opt.Stderr and the line callbacks.
+// When the terminal is the only destination and nothing needs redacting its
+// *os.File is handed to the command directly so the command still sees a TTY.
+func newStreams(opt *RunCmdOptions, stdoutCapture, stderrCapture io.Writer) *streams {
+	s := &streams{mu: &sync.Mutex{}, redactor: redactorFor(opt)}
+	s.stdout = s.redact(s.build(opt, stdoutCapture, os.Stdout, opt.Stdout, opt.OnStdoutLine))
+	s.stderrSink = s.build(opt, stderrCapture, os.Stderr, opt.Stderr, opt.OnStderrLine)
+	s.stderr = s.redact(s.stderrSink)
+	return s
+}
+
+func (s *streams) build(opt *RunCmdOptions, capture io.Writer, term *os.File, extra io.Writer, onLine func(string)) io.Writer {
+	if capture == nil && extra == nil && onLine == nil && opt.Prefix == "" {
+		if !opt.ShowOutput {
+			return nil
+		}
+		if s.redactor == nil {
+			// nothing to copy, hand the terminal over directly
+			return term
+		}
+	}
+
+	display := []io.Writer{}
+	if opt.ShowOutput {
+		display = append(display, term)
+	}
+	if extra != nil {
+		display = append(display, extra)
+	}
+
+	writers := []io.Writer{}
+	if capture != nil {
+		writers = append(writers, capture)
+	}
+	if len(display) > 0 {
+		var w io.Writer = io.MultiWriter(display...)
+		if opt.Prefix != "" {
+			pw := NewPrefixWriter(w, opt.Prefix, opt.PrefixColor)
+			s.flushers = append(s.flushers, pw)
+			w = pw
+		}
+		writers = append(writers, &lockedWriter{mu: s.mu, w: w})
+	}
+	if onLine != nil {
+		lw := NewLineWriter(onLine)
+		s.flushers = append(s.flushers, lw)
+		writers = append(writers, &lockedWriter{mu: s.mu, w: lw})
+	}
+
+	if len(writers) == 0 {
+		return nil
+	}
+	return io.MultiWriter(writers...)
+}
+
+// redact wraps w in a redacting writer when a redactor is set. The writer
+// buffers partial lines, so every goroutine writing to w needs its own.
+func (s *streams) redact(w io.Writer) io.Writer {
+	if w == nil || s.redactor == nil {
+		return w
+	}
+	rw := &redactWriter{r: s.redactor, w: w}
+	s.redacting = append(s.redacting, rw)
+	return rw
+}
+
+// flush writes out any partial lines held by prefix writers and line callbacks.
+func (s *streams) flush() {
+	// the redacting writers write through the locked writers, flush them first
+	for _, f := range s.redacting {
+		f.Flush()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.flushers {
+		f.Flush()
+	}
+}
@@ -0,0 +1,262 @@
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// PipelineResult is the outcome of RunPipeline. The embedded Result describes
+// the pipeline as a whole: Stdout of the last stage, Stderr of every stage and
+// the exit code of the rightmost failing stage, like "set -o pipefail".
+type PipelineResult struct {
+	*Result
+	// Stages holds the result of each command in pipeline order.
+	Stages []*Result
+}
+
+/*
+RunPipeline runs cmds connected stdout to stdin, like "cmdA | cmdB | cmdC",
+without going through a shell. opt applies to every stage; Input and Stdin
+feed the first stage and output options apply to the last stage's stdout and
+every stage's stderr. Cancelling ctx stops every stage.
+
+The pipeline fails if any stage fails, the returned *ExitError carries the
+pipeline Result with the exit code of the rightmost failing stage.
+
+Example:
+
+	res, err := terminal.RunPipeline(ctx, []*terminal.Cmd{
+		terminal.Command("kubectl", "get", "pods", "-o", "name"),
+		terminal.Command("grep", "api"),
+		terminal.Command("wc", "-l"),
+	}, nil)
+*/
+func RunPipeline(ctx context.Context, cmds []*Cmd, opt *RunCmdOptions) (*PipelineResult, error) {
+	if opt == nil {
+		opt = &RunCmdOptions{}
+	}
+	if len(cmds) == 0 {
+		return nil, errors.New("pipeline needs at least one command")
+	}
+
+	var cancel context.CancelFunc
+	if opt.CtxTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opt.CtxTimeout)
+		defer cancel()
+	}
+
+	pipeline := &Cmd{Script: pipelineString(cmds)}
+	start := time.Now()
+
+	var res *PipelineResult
+	var err error
+	switch {
+	case isDryRun(opt):
+		res = &PipelineResult{Result: runDry(pipeline, opt)}
+	case isOSExecutor(executorFor(opt)):
+		if opt.ShowOutput {
+			printRunning(opt, "running pipeline", pipeline.String())
+		}
+		res, err = runOSPipeline(ctx, pipeline, cmds, opt)
+	default:
+		res, err = runExecutorPipeline(ctx, pipeline, cmds, opt)
+	}
+
+	redact := redactorFor(opt)
+	redactResult(redact, res.Result, err)
+	for _, stage := range res.Stages {
+		redactResult(redact, stage, nil)
+	}
+
+	record(opt, res.Result, err, start)
+	return res, err
+}
+
+// runOSPipeline starts every stage as a process connected with os.Pipe.
+func runOSPipeline(ctx context.Context, pipeline *Cmd, cmds []*Cmd, opt *RunCmdOptions) (*PipelineResult, error) {
+	// a stage failing to start must stop the ones already running
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	readers := make([]*os.File, len(cmds))
+	writers := make([]*os.File, len(cmds))
+	for i := 0; i < len(cmds)-1; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closeFiles(readers...)
+			closeFiles(writers...)
+			res := &Result{Command: pipeline.String(), ExitCode: -1}
+			return &PipelineResult{Result: res}, &ExitError{Result: res, Err: fmt.Errorf("failed to create pipe: %w", err)}
+		}
+		// stage i writes to the pipe stage i+1 reads from
+		writers[i] = w
+		readers[i+1] = r
+	}
+
+	stdout := newCapture(opt)
+	stderrs := make([]capture, len(cmds))
+	// stderr is captured per stage, the streams only carry it to the display writers
+	out := newStreams(opt, stdout, nil)
+
+	execCmds := make([]*exec.Cmd, len(cmds))
+	errs := make([]error, len(cmds))
+	exited := make([]func(), len(cmds))
+	untrack := make([]func(), len(cmds))
+
+	start := time.Now()
+	for i, c := range cmds {
+		cmd, cleanup := newExecCmd(ctx, c, opt)
+		defer cleanup()
+		if ownProcessGroup(opt) {
+			setProcessGroup(cmd)
+		}
+		execCmds[i] = cmd
+
+		cmd.Stdin = stdinReader(opt)
+		if i > 0 {
+			cmd.Stdin = readers[i]
+		}
+		cmd.Stdout = out.stdout
+		if i < len(cmds)-1 {
+			cmd.Stdout = writers[i]
+		}
+		stderrs[i] = newCapture(opt)
+		var stderr io.Writer = stderrs[i]
+		if out.stderrSink != nil {
+			stderr = io.MultiWriter(stderrs[i], out.stderrSink)
+		}
+		// the stages write concurrently, each gets its own redacting writer
+		cmd.Stderr = out.redact(stderr)
+
+		exited[i] = gracefulCancel(cmd, opt)
+		if errs[i] = cmd.Start(); errs[i] != nil {
+			cancel()
+		} else {
+			untrack[i] = track(cmd)
+		}
+
+		// the children hold their own copies of the pipe ends
+		closeFiles(readers[i], writers[i])
+	}
+
+	for i, cmd := range execCmds {
+		if errs[i] == nil {
+			errs[i] = waitCmd(cmd)
+			untrack[i]()
+		}
+		exited[i]()
+	}
+	// the captures are complete once the redacting writers are flushed
+	out.flush()
+
+	stages := make([]*Result, len(cmds))
+	for i, cmd := range execCmds {
+		var stageOut []byte
+		captures := []capture{stderrs[i]}
+		if i == len(cmds)-1 {
+			stageOut = stdout.Bytes()
+			captures = append(captures, stdout)
+		}
+		stages[i], errs[i] = newResult(ctx, cmds[i], cmd, start, stageOut, stderrs[i].Bytes(), errs[i])
+		stages[i].Truncated = truncated(captures...)
+	}
+
+	return pipelineResult(ctx, pipeline, stages, errs, start)
+}
+
+func closeFiles(files ...*os.File) {
+	for _, f := range files {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// runExecutorPipeline runs the stages one after another through the
+// configured Executor, feeding each stage's stdout to the next one's stdin.
+// It lets fake executors serve pipelines.
+func runExecutorPipeline(ctx context.Context, pipeline *Cmd, cmds []*Cmd, opt *RunCmdOptions) (*PipelineResult, error) {
+	start := time.Now()
+	stages := make([]*Result, len(cmds))
+	errs := make([]error, len(cmds))
+	input := stdinReader(opt)
+
+	for i, c := range cmds {
+		stageOpt := *opt
+		stageOpt.Input = nil
+		stageOpt.Stdin = input
+		if i < len(cmds)-1 {
+			stageOpt.ShowOutput = false
+			stageOpt.Stdout = nil
+			stageOpt.OnStdoutLine = nil
+		}
+
+		stages[i], errs[i] = execOnce(ctx, c, &stageOpt)
+		input = bytes.NewReader(stages[i].Stdout)
+	}
+
+	return pipelineResult(ctx, pipeline, stages, errs, start)
+}
+
+// pipelineResult combines the stage results with pipefail semantics.
+func pipelineResult(ctx context.Context, pipeline *Cmd, stages []*Result, errs []error, start time.Time) (*PipelineResult, error) {
+	last := stages[len(stages)-1]
+	res := &PipelineResult{
+		Result: &Result{
+			Command:  pipeline.String(),
+			Stdout:   last.Stdout,
+			Duration: time.Since(start),
+			TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+		},
+		Stages: stages,
+	}
+
+	stderr := [][]byte{}
+	failed := -1
+	for i, stage := range stages {
+		stderr = append(stderr, stage.Stderr)
+		res.Truncated = res.Truncated || stage.Truncated
+		if errs[i] != nil {
+			failed = i
+		}
+	}
+	res.Stderr = bytes.Join(stderr, nil)
+
+	if failed < 0 {
+		return res, nil
+	}
+
+	cause := errs[failed]
+	var exitErr *ExitError
+	if errors.As(cause, &exitErr) {
+		cause = exitErr.Err
+	}
+
+	res.ExitCode = stages[failed].ExitCode
+	res.Signal = stages[failed].Signal
+	return res, &ExitError{
+		Result: res.Result,
+		Err:    fmt.Errorf("stage %d (%s): %w", failed+1, stages[failed].Command, cause),
+		ctxErr: ctx.Err(),
+	}
+}
+
+func pipelineString(cmds []*Cmd) string {
+	parts := make([]string, len(cmds))
+	for i, c := range cmds {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, " | ")
+}
+
+func isOSExecutor(e Executor) bool {
+	_, ok := e.(OSExecutor)
+	return ok
+}
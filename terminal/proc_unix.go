@@ -0,0 +1,84 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+// noTerminal reports whether we have no controlling terminal. Without one no
+// Ctrl-C or /dev/tty prompt can get lost by moving a command to its own
+// process group.
+var noTerminal = sync.OnceValue(func() bool {
+	f, err := os.Open("/dev/tty")
+	if err != nil {
+		return true
+	}
+	f.Close()
+	return false
+})
+
+// setProcessGroup starts cmd in a new process group so signals can be sent to
+// the command and everything it spawns.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// terminateProcess sends SIGTERM to the command's process group, or to the
+// process alone when it shares our group.
+func terminateProcess(cmd *exec.Cmd) error {
+	return signalProcess(cmd, syscall.SIGTERM)
+}
+
+// killProcess sends SIGKILL to the command's process group, or to the
+// process alone when it shares our group.
+func killProcess(cmd *exec.Cmd) error {
+	return signalProcess(cmd, syscall.SIGKILL)
+}
+
+func signalProcess(cmd *exec.Cmd, sig syscall.Signal) error {
+	if cmd.Process == nil {
+		return nil
+	}
+
+	pid := cmd.Process.Pid
+	if cmd.SysProcAttr != nil && (cmd.SysProcAttr.Setpgid || cmd.SysProcAttr.Setsid) {
+		// a negative pid signals the whole process group
+		pid = -pid
+	}
+	if err := syscall.Kill(pid, sig); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+	return nil
+}
+
+// exitSignal returns the signal that terminated the process, if any.
+func exitSignal(state *os.ProcessState) os.Signal {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return nil
+	}
+	return status.Signal()
+}
+
+// sendSignal sends sig to the command's process group, or to the process alone
+// when it shares our group.
+func sendSignal(cmd *exec.Cmd, sig os.Signal) error {
+	if s, ok := sig.(syscall.Signal); ok {
+		return signalProcess(cmd, s)
+	}
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Signal(sig)
+}
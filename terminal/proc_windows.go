@@ -0,0 +1,43 @@
+//go:build windows
+
+package terminal
+
+import (
+	"os"
+	"os/exec"
+)
+
+// noTerminal always returns false, windows has no process groups to move
+// commands to.
+func noTerminal() bool {
+	return false
+}
+
+// setProcessGroup is a no-op on windows.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminateProcess kills the process, windows has no SIGTERM equivalent.
+func terminateProcess(cmd *exec.Cmd) error {
+	return killProcess(cmd)
+}
+
+// killProcess kills the process.
+func killProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+// exitSignal always returns nil, windows processes are not stopped by signals.
+func exitSignal(state *os.ProcessState) os.Signal {
+	return nil
+}
+
+// sendSignal sends sig to the process, only os.Kill is supported on windows.
+func sendSignal(cmd *exec.Cmd, sig os.Signal) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Signal(sig)
+}
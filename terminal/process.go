@@ -0,0 +1,464 @@
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReadyTimeout  = 30 * time.Second
+	defaultReadyInterval = 100 * time.Millisecond
+	// maxProbeLine caps how much of a single output line is kept for matching
+	// readiness probes.
+	maxProbeLine = 64 << 10
+)
+
+// Process is a command started in the background with Start. It is safe for
+// concurrent use.
+type Process struct {
+	c   *Cmd
+	cmd *exec.Cmd
+
+	mu       sync.Mutex
+	stdout   capture
+	stderr   capture
+	watchers map[*lineWatch]struct{}
+
+	done chan struct{}
+	res  *Result
+	err  error
+}
+
+// running tracks every started process until it exits, for StopAll.
+var running = struct {
+	sync.Mutex
+	procs map[*Process]struct{}
+}{procs: map[*Process]struct{}{}}
+
+/*
+Start starts c in the background and returns once the process is running, for
+commands like port-forwards and local servers that are stopped later. The
+process runs in its own process group so Stop and Signal reach everything it
+spawns. Cancelling ctx or opt.CtxTimeout expiring stops it like Stop with
+opt.GracePeriod.
+
+Output is kept in memory, see Process.Stdout, and the output options of opt
+apply as for Exec; set CaptureLimit for long-running processes that log a lot.
+Start always starts a real process; Executor, Retry, Interactive and RunInPTY
+are ignored. In dry-run mode the command is printed and the returned Process
+has already exited.
+
+Example:
+
+	proc, err := terminal.Start(ctx, terminal.Command("kubectl", "port-forward", "svc/api", "8080:80"), nil)
+	if err != nil {
+		return err
+	}
+	defer proc.Stop(5 * time.Second)
+
+	if err := proc.WaitReady(ctx, &terminal.ReadinessProbe{TCPAddr: "localhost:8080"}); err != nil {
+		return err
+	}
+*/
+func Start(ctx context.Context, c *Cmd, opt *RunCmdOptions) (*Process, error) {
+	if opt == nil {
+		opt = &RunCmdOptions{}
+	}
+
+	p := &Process{
+		c:        c,
+		stdout:   newCapture(opt),
+		stderr:   newCapture(opt),
+		watchers: map[*lineWatch]struct{}{},
+		done:     make(chan struct{}),
+	}
+
+	start := time.Now()
+	if isDryRun(opt) {
+		p.res = runDry(c, opt)
+		close(p.done)
+		record(opt, p.res, nil, start)
+		return p, nil
+	}
+
+	var cancel context.CancelFunc = func() {}
+	if opt.CtxTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opt.CtxTimeout)
+	}
+
+	if opt.ShowOutput {
+		fmt.Printf("starting: %s\n", redactorFor(opt).Redact(c.String()))
+	}
+
+	var cleanup func()
+	p.cmd, cleanup = newExecCmd(ctx, c, opt)
+	setProcessGroup(p.cmd)
+
+	out := newStreams(opt, &processOutput{p: p, buf: p.stdout}, &processOutput{p: p, buf: p.stderr})
+	p.cmd.Stdout = out.stdout
+	p.cmd.Stderr = out.stderr
+	p.cmd.Stdin = stdinReader(opt)
+
+	exited := gracefulCancel(p.cmd, opt)
+	if err := p.cmd.Start(); err != nil {
+		exited()
+		cleanup()
+		cancel()
+		p.res, p.err = newResult(ctx, c, p.cmd, start, nil, nil, err)
+		redactResult(redactorFor(opt), p.res, p.err)
+		close(p.done)
+		record(opt, p.res, p.err, start)
+		return p, p.err
+	}
+
+	running.Lock()
+	running.procs[p] = struct{}{}
+	running.Unlock()
+	untrack := track(p.cmd)
+
+	go func() {
+		err := waitCmd(p.cmd)
+		untrack()
+		exited()
+		cleanup()
+		out.flush()
+
+		p.mu.Lock()
+		p.res, p.err = newResult(ctx, c, p.cmd, start, bytes.Clone(p.stdout.Bytes()), bytes.Clone(p.stderr.Bytes()), err)
+		p.res.Truncated = truncated(p.stdout, p.stderr)
+		redactResult(redactorFor(opt), p.res, p.err)
+		p.mu.Unlock()
+		cancel()
+
+		running.Lock()
+		delete(running.procs, p)
+		running.Unlock()
+
+		close(p.done)
+		record(opt, p.res, p.err, start)
+	}()
+
+	return p, nil
+}
+
+// processOutput appends to one of the process's output buffers and hands
+// every complete line to the readiness probes waiting for one.
+type processOutput struct {
+	p   *Process
+	buf capture
+	// line is the start of a line not terminated yet
+	line []byte
+}
+
+func (o *processOutput) Write(b []byte) (int, error) {
+	o.p.mu.Lock()
+	defer o.p.mu.Unlock()
+	o.buf.Write(b)
+
+	n := len(b)
+	for {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			o.keep(b)
+			return n, nil
+		}
+
+		line := b[:i]
+		if len(o.line) > 0 {
+			o.keep(line)
+			line = o.line
+		}
+		o.p.matchLine(line)
+		o.line = o.line[:0]
+		b = b[i+1:]
+	}
+}
+
+// keep adds b to the unterminated line, up to maxProbeLine bytes.
+func (o *processOutput) keep(b []byte) {
+	room := max(maxProbeLine-len(o.line), 0)
+	o.line = append(o.line, b[:min(len(b), room)]...)
+}
+
+// lineWatch is a readiness probe waiting for a line of output matching re,
+// ready is closed once one does.
+type lineWatch struct {
+	re    *regexp.Regexp
+	ready chan struct{}
+}
+
+// watch starts matching re against the process's output, including the
+// complete lines already kept. The caller must unwatch it.
+func (p *Process) watch(re *regexp.Regexp) *lineWatch {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w := &lineWatch{re: re, ready: make(chan struct{})}
+	if matchLines(re, p.stdout.Bytes()) || matchLines(re, p.stderr.Bytes()) {
+		close(w.ready)
+		return w
+	}
+	p.watchers[w] = struct{}{}
+	return w
+}
+
+func (p *Process) unwatch(w *lineWatch) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.watchers, w)
+}
+
+// matchLine closes the watches line matches, p.mu must be held.
+func (p *Process) matchLine(line []byte) {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	for w := range p.watchers {
+		if w.re.Match(line) {
+			close(w.ready)
+			delete(p.watchers, w)
+		}
+	}
+}
+
+// PID returns the process id, 0 if the process never started.
+func (p *Process) PID() int {
+	if p.cmd == nil || p.cmd.Process == nil {
+		return 0
+	}
+	return p.cmd.Process.Pid
+}
+
+// Stdout returns a copy of what the process has written to stdout so far,
+// cut down like Result.Stdout when RunCmdOptions.CaptureLimit is set.
+func (p *Process) Stdout() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return bytes.Clone(p.stdout.Bytes())
+}
+
+// Stderr returns a copy of what the process has written to stderr so far, see
+// Stdout.
+func (p *Process) Stderr() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return bytes.Clone(p.stderr.Bytes())
+}
+
+// Done is closed once the process has exited.
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait waits for the process to exit and returns its Result, the error is an
+// *ExitError when it failed.
+func (p *Process) Wait() (*Result, error) {
+	<-p.done
+	return p.res, p.err
+}
+
+// Signal sends sig to the process group.
+func (p *Process) Signal(sig os.Signal) error {
+	select {
+	case <-p.done:
+		return os.ErrProcessDone
+	default:
+	}
+
+	if err := sendSignal(p.cmd, sig); err != nil {
+		return fmt.Errorf("failed to signal %s: %w", p.c, err)
+	}
+	return nil
+}
+
+// Stop sends SIGTERM to the process group and waits for the process to exit,
+// sending SIGKILL if it is still running after grace. A grace of zero kills it
+// straight away. Anything left in the process group once the process has exited
+// is killed. Stopping an exited process is a no-op.
+func (p *Process) Stop(grace time.Duration) error {
+	if p.cmd == nil {
+		return nil
+	}
+
+	if grace > 0 {
+		if err := terminateProcess(p.cmd); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return fmt.Errorf("failed to stop %s: %w", p.c, err)
+		}
+		select {
+		case <-p.done:
+		case <-time.After(grace):
+		}
+	}
+
+	// the process may have exited but left children behind in its group
+	if err := killProcess(p.cmd); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		select {
+		case <-p.done:
+			return nil
+		default:
+			return fmt.Errorf("failed to kill %s: %w", p.c, err)
+		}
+	}
+	<-p.done
+	return nil
+}
+
+// StopAll stops every process started with Start that is still running, see
+// Process.Stop. Call it before the program exits so no process group is left
+// behind.
+func StopAll(grace time.Duration) error {
+	running.Lock()
+	procs := make([]*Process, 0, len(running.procs))
+	for p := range running.procs {
+		procs = append(procs, p)
+	}
+	running.Unlock()
+
+	errs := make([]error, len(procs))
+	wg := sync.WaitGroup{}
+	for i, p := range procs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = p.Stop(grace)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+/*
+ReadinessProbe tells Process.WaitReady when a started process is ready to use.
+When both LogLine and TCPAddr are set both must pass.
+
+Example:
+
+	probe := &terminal.ReadinessProbe{
+		LogLine: regexp.MustCompile(`Forwarding from 127\.0\.0\.1:8080`),
+		Timeout: 10 * time.Second,
+	}
+*/
+type ReadinessProbe struct {
+	// LogLine passes once a line of stdout or stderr matches.
+	LogLine *regexp.Regexp
+	// TCPAddr passes once a TCP connection to it succeeds, for example "localhost:8080".
+	TCPAddr string
+	// Timeout is how long to wait for the process to become ready. Defaults to 30 seconds.
+	Timeout time.Duration
+	// Interval is how often TCPAddr is dialled. Defaults to 100 milliseconds.
+	Interval time.Duration
+}
+
+// WaitReady blocks until probe passes. It fails if the process exits first,
+// probe.Timeout expires or ctx is cancelled; the process is left running
+// unless it exited. Lines dropped by RunCmdOptions.CaptureLimit before WaitReady
+// is called are not matched. A Process started in dry-run mode is always ready.
+func (p *Process) WaitReady(ctx context.Context, probe *ReadinessProbe) error {
+	select {
+	case <-p.done:
+		if p.res.DryRun {
+			return nil
+		}
+	default:
+	}
+
+	timeout := probe.Timeout
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+	interval := probe.Interval
+	if interval <= 0 {
+		interval = defaultReadyInterval
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logReady := probe.LogLine == nil
+	tcpReady := probe.TCPAddr == ""
+	var logLine <-chan struct{}
+	if !logReady {
+		w := p.watch(probe.LogLine)
+		defer p.unwatch(w)
+		logLine = w.ready
+	}
+
+	for {
+		if !tcpReady {
+			tcpReady = dialable(ctx, probe.TCPAddr, interval)
+		}
+		if logReady && tcpReady {
+			return nil
+		}
+
+		select {
+		case <-logLine:
+			logReady = true
+			// a closed channel is always ready, stop selecting it
+			logLine = nil
+		case <-ticker.C:
+		case <-p.done:
+			// all output is written before done is closed, the ready line may be the last one
+			select {
+			case <-logLine:
+				logReady = true
+			default:
+			}
+			if logReady && tcpReady {
+				return nil
+			}
+			return fmt.Errorf("%s exited before becoming ready: %w", p.c, exitCause(p.err))
+		case <-deadline.C:
+			return fmt.Errorf("%s not ready after %s", p.c, timeout)
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %s to become ready: %w", p.c, ctx.Err())
+		}
+	}
+}
+
+// matchLines reports whether a complete line of output matches re.
+func matchLines(re *regexp.Regexp, output []byte) bool {
+	end := bytes.LastIndexByte(output, '\n')
+	if end < 0 {
+		return false
+	}
+
+	for line := range strings.Lines(string(output[:end+1])) {
+		if re.MatchString(strings.TrimRight(line, "\r\n")) {
+			return true
+		}
+	}
+	return false
+}
+
+func dialable(ctx context.Context, addr string, timeout time.Duration) bool {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// exitCause describes why a process exited, err is nil for a clean exit.
+func exitCause(err error) error {
+	if err == nil {
+		return errors.New("exit code 0")
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Err
+	}
+	return err
+}
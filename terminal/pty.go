@@ -0,0 +1,104 @@
+package terminal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/mcsteele8/common-cli-utils/internal/termcap"
+
+	"golang.org/x/term"
+)
+
+// ErrPTYUnsupported is returned when RunCmdOptions.RunInPTY is used on a
+// platform without pseudo-terminal support.
+var ErrPTYUnsupported = errors.New("running in a pseudo-terminal is not supported on this platform")
+
+// runPTY runs c attached to a new pseudo-terminal. The terminal's window size
+// is kept in sync with ours, our stdin is forwarded in raw mode when it is a
+// terminal and everything the command writes is captured as a transcript.
+func runPTY(ctx context.Context, c *Cmd, opt *RunCmdOptions) (*Result, error) {
+	if opt.ShowOutput {
+		printRunning(opt, "running script", c.String())
+	}
+
+	cmd, cleanup := newExecCmd(ctx, c, opt)
+	defer cleanup()
+	start := time.Now()
+
+	master, slave, err := openPTY()
+	if err != nil {
+		return newResult(ctx, c, cmd, start, nil, nil, err)
+	}
+	defer master.Close()
+
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	setControllingTTY(cmd)
+
+	stdinFd := int(os.Stdin.Fd())
+	stdinIsTerminal := termcap.IsTerminal(os.Stdin.Fd())
+	if stdinIsTerminal {
+		stopResize := forwardResize(os.Stdin, master)
+		defer stopResize()
+
+		oldState, err := term.MakeRaw(stdinFd)
+		if err == nil {
+			defer term.Restore(stdinFd, oldState)
+			// exiting on a signal skips the deferred restore
+			stop := restoreOnSignal(func() { term.Restore(stdinFd, oldState) })
+			defer stop()
+		}
+	}
+
+	transcript := newCapture(opt)
+	out := newStreams(opt, transcript, nil)
+
+	exited := gracefulCancel(cmd, opt)
+	defer exited()
+
+	if err := cmd.Start(); err != nil {
+		slave.Close()
+		return newResult(ctx, c, cmd, start, nil, nil, err)
+	}
+	// the child holds its own copy, closing ours lets reads on master end once it exits
+	slave.Close()
+	untrack := track(cmd)
+	defer untrack()
+
+	copyDone := make(chan struct{})
+	go func() {
+		// reading master fails with EIO once the last slave fd is closed
+		io.Copy(out.stdout, master)
+		close(copyDone)
+	}()
+
+	stopInput := make(chan struct{})
+	stdin := stdinReader(opt)
+	switch {
+	case stdin != nil:
+		go io.Copy(master, stdin)
+	case stdinIsTerminal:
+		go forwardInput(os.Stdin, master, stopInput)
+	}
+
+	err = waitCmd(cmd)
+	<-copyDone
+	close(stopInput)
+	out.flush()
+
+	res, err := newResult(ctx, c, cmd, start, transcript.Bytes(), nil, ignoreEIO(err))
+	res.Truncated = truncated(transcript)
+	return res, err
+}
+
+func ignoreEIO(err error) error {
+	if errors.Is(err, syscall.EIO) {
+		return nil
+	}
+	return err
+}
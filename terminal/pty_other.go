@@ -0,0 +1,20 @@
+//go:build !linux
+
+package terminal
+
+import (
+	"os"
+	"os/exec"
+)
+
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, ErrPTYUnsupported
+}
+
+func setControllingTTY(cmd *exec.Cmd) {}
+
+func forwardResize(from, pty *os.File) func() {
+	return func() {}
+}
+
+func forwardInput(from, pty *os.File, stop <-chan struct{}) {}
@@ -0,0 +1,154 @@
+package terminal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	dryRun          atomic.Bool
+	sessionRecorder atomic.Pointer[Recorder]
+)
+
+// SetDryRun turns dry-run mode on or off for every command run by this
+// package, see RunCmdOptions.DryRun.
+func SetDryRun(enabled bool) {
+	dryRun.Store(enabled)
+}
+
+// SetRecorder records every command run by this package to r, pass nil to
+// stop recording.
+func SetRecorder(r *Recorder) {
+	sessionRecorder.Store(r)
+}
+
+// Record describes a single command run, or skipped in dry-run mode.
+type Record struct {
+	Command   string        `json:"command"`
+	Cwd       string        `json:"cwd"`
+	Env       []string      `json:"env,omitempty"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration_ns"`
+	ExitCode  int           `json:"exit_code"`
+	DryRun    bool          `json:"dry_run,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Recorder collects a Record for every command it sees, for auditing what a
+// session executed. The probes the package runs for itself, the version checks
+// of Check and Require and the sudo password check, are not recorded. It is
+// safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) add(rec Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, rec)
+}
+
+// Records returns a copy of everything recorded so far.
+func (r *Recorder) Records() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Record{}, r.records...)
+}
+
+// WriteJSON writes the records as an indented JSON array.
+func (r *Recorder) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.Records())
+}
+
+// Save writes the records as JSON to the file at path.
+func (r *Recorder) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create command log %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := r.WriteJSON(f); err != nil {
+		return fmt.Errorf("failed to write command log %s: %w", path, err)
+	}
+	return nil
+}
+
+func isDryRun(opt *RunCmdOptions) bool {
+	return opt.DryRun || dryRun.Load()
+}
+
+// runDry prints what c would do without running it.
+func runDry(c *Cmd, opt *RunCmdOptions) *Result {
+	redact := redactorFor(opt)
+	fmt.Printf("[dry-run] would run: %s\n", redact.Redact(c.String()))
+	fmt.Printf("[dry-run]   cwd: %s\n", commandDir(opt))
+	for _, line := range envForDisplay(opt, envDiff(opt)) {
+		fmt.Printf("[dry-run]   env: %s\n", redact.Redact(line))
+	}
+
+	return &Result{
+		Command: c.String(),
+		DryRun:  true,
+	}
+}
+
+// record adds the finished command to the per-call and session recorders.
+func record(opt *RunCmdOptions, res *Result, err error, start time.Time) {
+	recorders := []*Recorder{opt.Recorder}
+	if r := sessionRecorder.Load(); r != nil && r != opt.Recorder {
+		recorders = append(recorders, r)
+	}
+
+	env := envForDisplay(opt, opt.Env)
+	if redact := redactorFor(opt); redact != nil {
+		redacted := make([]string, len(env))
+		for i, kv := range env {
+			redacted[i] = redact.Redact(kv)
+		}
+		env = redacted
+	}
+
+	rec := Record{
+		Command:   res.Command,
+		Cwd:       commandDir(opt),
+		Env:       env,
+		StartedAt: start,
+		Duration:  res.Duration,
+		ExitCode:  res.ExitCode,
+		DryRun:    res.DryRun,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	for _, r := range recorders {
+		if r != nil {
+			r.add(rec)
+		}
+	}
+}
+
+// commandDir returns the directory a command runs in.
+func commandDir(opt *RunCmdOptions) string {
+	if opt.Cwd != "" {
+		return opt.Cwd
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+	return dir
+}
@@ -0,0 +1,165 @@
+package terminal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+const redactedMask = "*****"
+
+var sessionRedactor atomic.Pointer[Redactor]
+
+// SetRedactor masks r's secrets in every command run by this package in
+// addition to RunCmdOptions.Redact, pass nil to stop.
+func SetRedactor(r *Redactor) {
+	sessionRedactor.Store(r)
+}
+
+/*
+Redactor masks secrets before they reach the terminal, captured output, errors
+and recorders. It is applied to the echoed command, the Result's Command,
+Stdout and Stderr, *ExitError messages, dry-run output and recorded commands
+and environment variables.
+
+Output is redacted a line at a time so a secret split across writes is still
+found, which means a partial line, like a prompt without a trailing newline,
+is only shown once it is completed or the command exits. The terminal is no
+longer handed to the command directly, so it does not see a TTY.
+
+Example:
+
+	opt := &terminal.RunCmdOptions{
+		ShowOutput: true,
+		Redact: &terminal.Redactor{
+			Literals: []string{os.Getenv("GITHUB_TOKEN")},
+			Patterns: []*regexp.Regexp{regexp.MustCompile(`--password[= ](\S+)`)},
+		},
+	}
+*/
+type Redactor struct {
+	// Literals are masked wherever they appear. Empty strings are ignored.
+	Literals []string
+	// Patterns mask every match, or only the text matched by their capture
+	// groups when they have any, for example `token=(\S+)`.
+	Patterns []*regexp.Regexp
+}
+
+// Redact returns s with every secret masked. A nil Redactor returns s as is.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+
+	for _, lit := range r.Literals {
+		if lit != "" {
+			s = strings.ReplaceAll(s, lit, redactedMask)
+		}
+	}
+	for _, re := range r.Patterns {
+		if re.NumSubexp() == 0 {
+			s = re.ReplaceAllLiteralString(s, redactedMask)
+			continue
+		}
+		s = redactGroups(re, s)
+	}
+	return s
+}
+
+// redactGroups masks the text matched by re's capture groups.
+func redactGroups(re *regexp.Regexp, s string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	sb := strings.Builder{}
+	last := 0
+	for _, m := range matches {
+		for g := 2; g < len(m); g += 2 {
+			start, end := m[g], m[g+1]
+			// skip groups that did not take part in the match or sit inside one already masked
+			if start < 0 || start < last {
+				continue
+			}
+			sb.WriteString(s[last:start])
+			sb.WriteString(redactedMask)
+			last = end
+		}
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+// redactorFor combines opt.Redact with the session redactor, nil when neither
+// is set.
+func redactorFor(opt *RunCmdOptions) *Redactor {
+	session := sessionRedactor.Load()
+	switch {
+	case session == nil:
+		return opt.Redact
+	case opt.Redact == nil || opt.Redact == session:
+		return session
+	}
+
+	return &Redactor{
+		Literals: append(append([]string{}, opt.Redact.Literals...), session.Literals...),
+		Patterns: append(append([]*regexp.Regexp{}, opt.Redact.Patterns...), session.Patterns...),
+	}
+}
+
+// redactResult masks secrets in res.Command and makes err, and the errors of
+// earlier attempts, mask their messages. Output is masked as it is written.
+func redactResult(r *Redactor, res *Result, err error) {
+	if r == nil || res == nil {
+		return
+	}
+
+	res.Command = r.Redact(res.Command)
+	setRedactor(r, err)
+	for _, attempt := range res.Attempts {
+		setRedactor(r, attempt.Err)
+	}
+}
+
+func setRedactor(r *Redactor, err error) {
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		exitErr.redactor = r
+	}
+}
+
+// redactWriter masks secrets in every line before writing it to w.
+type redactWriter struct {
+	r   *Redactor
+	w   io.Writer
+	buf []byte
+}
+
+func (rw *redactWriter) Write(p []byte) (int, error) {
+	rw.buf = append(rw.buf, p...)
+	end := bytes.LastIndexByte(rw.buf, '\n')
+	if end < 0 {
+		return len(p), nil
+	}
+
+	lines := string(rw.buf[:end+1])
+	rw.buf = rw.buf[end+1:]
+	if _, err := io.WriteString(rw.w, rw.r.Redact(lines)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes any trailing text that did not end in a newline.
+func (rw *redactWriter) Flush() error {
+	if len(rw.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(rw.w, rw.r.Redact(string(rw.buf)))
+	rw.buf = nil
+	return err
+}
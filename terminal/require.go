@@ -0,0 +1,223 @@
+package terminal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const versionTimeout = 10 * time.Second
+
+// knownVersionArgs are the version arguments of tools that do not support
+// "--version".
+var knownVersionArgs = map[string][]string{
+	"kubectl": {"version", "--client"},
+	"helm":    {"version", "--short"},
+	"go":      {"version"},
+}
+
+// Requirement is a program the CLI needs on PATH.
+type Requirement struct {
+	// Name is the program looked up in PATH, for example "kubectl".
+	Name string
+	// Version constrains the installed version, for example ">=1.28",
+	// ">=3.0 <4", "^2.1" or "~1.2". Any version is accepted when empty.
+	Version string
+	// VersionArgs print the program's version. Defaults to "--version", or the
+	// right arguments for kubectl, helm and go.
+	VersionArgs []string
+	// VersionPattern finds the version in the output, its first capture group
+	// is used when it has one. Defaults to the first "x.y.z" found.
+	VersionPattern *regexp.Regexp
+	// InstallHint tells the user how to install the program, for example a URL
+	// or "brew install helm".
+	InstallHint string
+}
+
+// RequirementResult is the outcome of checking a single Requirement.
+type RequirementResult struct {
+	Requirement
+	// Path is where the program was found, empty when it is missing.
+	Path string
+	// Found is the installed version, empty when it was not checked.
+	Found string
+	// Err says why the requirement is not met, nil when it is.
+	Err error
+}
+
+// RequirementResults holds the results of Check in the order the requirements
+// were given.
+type RequirementResults []*RequirementResult
+
+// RequirementsError is returned by Require when a requirement is not met, its
+// message is a report of every unmet requirement and how to install it.
+type RequirementsError struct {
+	Unmet RequirementResults
+}
+
+func (e *RequirementsError) Error() string {
+	return "missing prerequisites:\n" + e.Unmet.Report()
+}
+
+// Which returns the path of the program name on PATH, or as reported by the
+// package-wide Executor when it is a PathLooker.
+func Which(name string) (string, error) {
+	path, err := lookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to find %s: %w", name, err)
+	}
+	return path, nil
+}
+
+/*
+Require checks every requirement and returns a *RequirementsError describing
+all the unmet ones, so users learn about everything they need to install at
+once instead of one failure at a time.
+
+Example:
+
+	err := terminal.Require(ctx,
+		terminal.Requirement{Name: "kubectl", Version: ">=1.28", InstallHint: "https://kubernetes.io/docs/tasks/tools/"},
+		terminal.Requirement{Name: "helm", Version: "^3.12", InstallHint: "brew install helm"},
+		terminal.Requirement{Name: "git"},
+	)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+prints
+
+	missing prerequisites:
+	  kubectl: not found in PATH
+	    install: https://kubernetes.io/docs/tasks/tools/
+	  helm: version 3.8.1 does not satisfy ^3.12
+	    install: brew install helm
+*/
+func Require(ctx context.Context, reqs ...Requirement) error {
+	return Check(ctx, reqs...).Err()
+}
+
+// Check checks every requirement, running each program with its version
+// arguments when a Version constraint is set. The version probes go through the
+// package-wide Executor, they run even in dry-run mode and are not recorded.
+func Check(ctx context.Context, reqs ...Requirement) RequirementResults {
+	results := make(RequirementResults, len(reqs))
+	for i, req := range reqs {
+		results[i] = checkRequirement(ctx, req)
+	}
+	return results
+}
+
+func checkRequirement(ctx context.Context, req Requirement) *RequirementResult {
+	res := &RequirementResult{Requirement: req}
+
+	path, err := lookPath(req.Name)
+	if err != nil {
+		res.Err = errors.New("not found in PATH")
+		return res
+	}
+	res.Path = path
+
+	if req.Version == "" {
+		return res
+	}
+
+	found, err := installedVersion(ctx, req)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Found = found
+
+	v, err := parseVersion(found)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	ok, err := satisfies(v, req.Version)
+	switch {
+	case err != nil:
+		res.Err = err
+	case !ok:
+		res.Err = fmt.Errorf("version %s does not satisfy %s", found, req.Version)
+	}
+	return res
+}
+
+// installedVersion runs req's program with its version arguments and finds
+// the version in stdout, or in stderr for tools that print it there.
+func installedVersion(ctx context.Context, req Requirement) (string, error) {
+	args := req.VersionArgs
+	if args == nil {
+		args = knownVersionArgs[req.Name]
+	}
+	if args == nil {
+		args = []string{"--version"}
+	}
+	pattern := req.VersionPattern
+	if pattern == nil {
+		pattern = versionPattern
+	}
+
+	// the probe only reads, so it skips dry-run and recording by bypassing Exec
+	res, err := execOnce(ctx, Command(req.Name, args...), &RunCmdOptions{CtxTimeout: versionTimeout})
+	for _, output := range [][]byte{res.Stdout, res.Stderr} {
+		m := pattern.FindSubmatch(output)
+		switch {
+		case m == nil:
+			continue
+		case pattern != versionPattern && len(m) > 1:
+			return strings.TrimPrefix(string(m[1]), "v"), nil
+		}
+		return strings.TrimPrefix(string(m[0]), "v"), nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to get version with %s: %w", QuoteArgs(append([]string{req.Name}, args...)...), exitCause(err))
+	}
+	return "", fmt.Errorf("no version found in the output of %s", QuoteArgs(append([]string{req.Name}, args...)...))
+}
+
+// Unmet returns the requirements that are not met.
+func (r RequirementResults) Unmet() RequirementResults {
+	unmet := RequirementResults{}
+	for _, res := range r {
+		if res.Err != nil {
+			unmet = append(unmet, res)
+		}
+	}
+	return unmet
+}
+
+// Err returns a *RequirementsError when a requirement is not met, nil otherwise.
+func (r RequirementResults) Err() error {
+	unmet := r.Unmet()
+	if len(unmet) == 0 {
+		return nil
+	}
+	return &RequirementsError{Unmet: unmet}
+}
+
+// Report renders a line for every result with the reason it is unmet and its
+// install hint.
+func (r RequirementResults) Report() string {
+	sb := strings.Builder{}
+	for _, res := range r {
+		switch {
+		case res.Err != nil:
+			fmt.Fprintf(&sb, "  %s: %s\n", res.Name, res.Err)
+			if res.InstallHint != "" {
+				fmt.Fprintf(&sb, "    install: %s\n", res.InstallHint)
+			}
+		case res.Found != "":
+			fmt.Fprintf(&sb, "  %s: ok (%s, %s)\n", res.Name, res.Found, res.Path)
+		default:
+			fmt.Fprintf(&sb, "  %s: ok (%s)\n", res.Name, res.Path)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,102 @@
+package terminal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Result holds the outcome of a finished command.
+type Result struct {
+	// Command is the command as it would be typed into a shell.
+	Command string
+	// ExitCode is the process exit code, or -1 when the process did not exit
+	// normally (killed by a signal or never started).
+	ExitCode int
+	Stdout   []byte
+	Stderr   []byte
+	Duration time.Duration
+	// Signal is the signal that terminated the process, nil if it exited normally.
+	Signal os.Signal
+	// TimedOut is set when the command was stopped because its timeout or
+	// context deadline expired.
+	TimedOut bool
+	// Truncated is set when Stdout or Stderr was cut down to
+	// RunCmdOptions.CaptureLimit.
+	Truncated bool
+	// Attempts records every attempt made when RunCmdOptions.Retry is set,
+	// the last entry matches this Result.
+	Attempts []Attempt
+	// DryRun is set when the command was only printed, see RunCmdOptions.DryRun.
+	DryRun bool
+}
+
+// Attempt is the outcome of a single attempt at running a command.
+type Attempt struct {
+	ExitCode int
+	Duration time.Duration
+	Err      error
+	// Backoff is how long we waited after this attempt before the next one.
+	Backoff time.Duration
+}
+
+// ExitError is returned when a command fails to start or exits unsuccessfully.
+// Use errors.As to branch on the exit code:
+//
+//	var exitErr *terminal.ExitError
+//	if errors.As(err, &exitErr) && exitErr.ExitCode == 1 {
+//		...
+//	}
+type ExitError struct {
+	*Result
+	// Err is the underlying error from os/exec.
+	Err error
+
+	ctxErr   error
+	redactor *Redactor
+}
+
+func (e *ExitError) Error() string {
+	return e.redactor.Redact(fmt.Sprintf("failed to run script -> %s | error code: %s | error message: %s", e.Command, e.Err.Error(), e.Stderr))
+}
+
+// Unwrap returns the os/exec error and, when the command was cancelled, the
+// context error so errors.Is(err, context.DeadlineExceeded) works.
+func (e *ExitError) Unwrap() []error {
+	if e.ctxErr != nil {
+		return []error{e.Err, e.ctxErr}
+	}
+	return []error{e.Err}
+}
+
+// newResult builds the Result of cmd after it has run and wraps err in an
+// *ExitError when the command failed.
+func newResult(ctx context.Context, c *Cmd, cmd *exec.Cmd, start time.Time, stdout, stderr []byte, err error) (*Result, error) {
+	res := &Result{
+		Command:  c.String(),
+		ExitCode: -1,
+		Stdout:   stdout,
+		Stderr:   stderr,
+		Duration: time.Since(start),
+		TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
+
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+		res.Signal = exitSignal(cmd.ProcessState)
+	}
+
+	if err == nil || errors.Is(err, io.ErrShortWrite) {
+		return res, nil
+	}
+
+	return res, &ExitError{
+		Result: res,
+		Err:    err,
+		ctxErr: ctx.Err(),
+	}
+}
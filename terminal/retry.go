@@ -0,0 +1,116 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"time"
+)
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 30 * time.Second
+	defaultMultiplier     = 2
+)
+
+/*
+RetryPolicy reruns a failed command with exponential backoff.
+
+With neither RetryOnExitCodes nor RetryOnStderr set every failure is retried,
+otherwise only failures matching one of them are. A cancelled context is never
+retried. Use RunCmdOptions.Input rather than Stdin so every attempt gets the
+same stdin.
+
+Example:
+
+	opt := &terminal.RunCmdOptions{
+		Retry: &terminal.RetryPolicy{
+			MaxAttempts:   4,
+			Jitter:        0.2,
+			RetryOnStderr: regexp.MustCompile(`(?i)timeout|connection reset`),
+		},
+	}
+	res, err := terminal.Exec(ctx, terminal.Command("helm", "repo", "update"), opt)
+*/
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait before the second attempt. Defaults to 1 second.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts. Defaults to 30 seconds.
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after every attempt. Defaults to 2.
+	Multiplier float64
+	// Jitter randomizes each backoff by up to this fraction, 0.2 means +/-20%.
+	Jitter float64
+	// RetryOnExitCodes limits retries to these exit codes.
+	RetryOnExitCodes []int
+	// RetryOnStderr limits retries to failures whose stderr matches.
+	RetryOnStderr *regexp.Regexp
+}
+
+func (p *RetryPolicy) run(ctx context.Context, c *Cmd, opt *RunCmdOptions) (*Result, error) {
+	attempts := []Attempt{}
+
+	for attempt := 1; ; attempt++ {
+		res, err := execOnce(ctx, c, opt)
+		attempts = append(attempts, Attempt{
+			ExitCode: res.ExitCode,
+			Duration: res.Duration,
+			Err:      err,
+		})
+
+		if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !p.shouldRetry(res) {
+			res.Attempts = attempts
+			return res, err
+		}
+
+		backoff := p.backoff(attempt)
+		attempts[len(attempts)-1].Backoff = backoff
+		if opt.ShowOutput {
+			fmt.Printf("attempt %d/%d failed with exit code %d, retrying in %s\n", attempt, p.MaxAttempts, res.ExitCode, backoff.Round(time.Millisecond))
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			res.Attempts = attempts
+			return res, err
+		}
+	}
+}
+
+func (p *RetryPolicy) shouldRetry(res *Result) bool {
+	if len(p.RetryOnExitCodes) == 0 && p.RetryOnStderr == nil {
+		return true
+	}
+	if slices.Contains(p.RetryOnExitCodes, res.ExitCode) {
+		return true
+	}
+	return p.RetryOnStderr != nil && p.RetryOnStderr.Match(res.Stderr)
+}
+
+// backoff returns the wait after the given attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = defaultMultiplier
+	}
+
+	backoff := math.Min(float64(initial)*math.Pow(multiplier, float64(attempt-1)), float64(maxBackoff))
+	if p.Jitter > 0 {
+		backoff *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(backoff)
+}
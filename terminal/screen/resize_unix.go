@@ -0,0 +1,18 @@
+//go:build !windows
+
+package screen
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyResize delivers SIGWINCH on the returned channel.
+func notifyResize(s *Screen) (<-chan os.Signal, func()) {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	return winch, func() {
+		signal.Stop(winch)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build windows
+
+package screen
+
+import (
+	"time"
+)
+
+const resizePollInterval = 250 * time.Millisecond
+
+// notifyResize polls the console size, windows has no SIGWINCH.
+func notifyResize(s *Screen) (<-chan struct{}, func()) {
+	resized := make(chan struct{}, 1)
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(resizePollInterval)
+		defer ticker.Stop()
+
+		width, height := s.Size()
+		for {
+			select {
+			case <-ticker.C:
+				w, h := s.Size()
+				if w == width && h == height {
+					continue
+				}
+				width, height = w, h
+				select {
+				case resized <- struct{}{}:
+				default:
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return resized, func() {
+		close(done)
+	}
+}
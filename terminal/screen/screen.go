@@ -0,0 +1,199 @@
+/*
+Package screen controls the cursor and the screen of a terminal with ANSI
+escape sequences. Every method is a no-op when the writer is not a terminal,
+so output redirected to a file or a CI log stays free of escape codes.
+
+Example:
+
+	scr := screen.New(os.Stdout)
+	scr.HideCursor()
+	defer scr.ShowCursor()
+
+	for i, frame := range frames {
+		if i > 0 {
+			// redraw over the previous frame
+			scr.ClearLines(len(frames[i-1]))
+		}
+		fmt.Print(strings.Join(frame, "\n"))
+	}
+*/
+package screen
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mcsteele8/common-cli-utils/internal/termcap"
+
+	"golang.org/x/term"
+)
+
+const esc = "\033"
+
+// Screen writes escape sequences to a terminal.
+type Screen struct {
+	w   io.Writer
+	fd  int
+	tty bool
+}
+
+// New returns a Screen writing to w. It only writes when w is an *os.File
+// attached to a terminal.
+func New(w io.Writer) *Screen {
+	s := &Screen{w: w, fd: -1}
+	if f, ok := w.(*os.File); ok {
+		s.fd = int(f.Fd())
+		s.tty = termcap.IsTerminal(f.Fd())
+	}
+	return s
+}
+
+// NewTTY returns a Screen that treats w as a terminal, for writers like an SSH
+// session or a pseudo-terminal that New cannot detect.
+func NewTTY(w io.Writer) *Screen {
+	s := New(w)
+	s.tty = true
+	return s
+}
+
+// IsTTY reports whether the Screen writes escape sequences.
+func (s *Screen) IsTTY() bool {
+	return s.tty
+}
+
+// Size returns the terminal width and height in cells, 0, 0 when it is unknown.
+func (s *Screen) Size() (width, height int) {
+	if s.fd < 0 {
+		return 0, 0
+	}
+	width, height, err := term.GetSize(s.fd)
+	if err != nil {
+		return 0, 0
+	}
+	return width, height
+}
+
+func (s *Screen) write(seq string) error {
+	if !s.tty {
+		return nil
+	}
+	_, err := io.WriteString(s.w, seq)
+	return err
+}
+
+// HideCursor makes the cursor invisible.
+func (s *Screen) HideCursor() error {
+	return s.write(esc + "[?25l")
+}
+
+// ShowCursor makes the cursor visible again.
+func (s *Screen) ShowCursor() error {
+	return s.write(esc + "[?25h")
+}
+
+// SaveCursor remembers the cursor position for RestoreCursor.
+func (s *Screen) SaveCursor() error {
+	return s.write(esc + "7")
+}
+
+// RestoreCursor moves the cursor back to the position saved by SaveCursor.
+func (s *Screen) RestoreCursor() error {
+	return s.write(esc + "8")
+}
+
+// MoveUp moves the cursor up n lines.
+func (s *Screen) MoveUp(n int) error {
+	return s.move(n, 'A')
+}
+
+// MoveDown moves the cursor down n lines.
+func (s *Screen) MoveDown(n int) error {
+	return s.move(n, 'B')
+}
+
+// MoveRight moves the cursor right n columns.
+func (s *Screen) MoveRight(n int) error {
+	return s.move(n, 'C')
+}
+
+// MoveLeft moves the cursor left n columns.
+func (s *Screen) MoveLeft(n int) error {
+	return s.move(n, 'D')
+}
+
+func (s *Screen) move(n int, direction byte) error {
+	if n <= 0 {
+		return nil
+	}
+	return s.write(fmt.Sprintf("%s[%d%c", esc, n, direction))
+}
+
+// MoveTo moves the cursor to row and col, both starting at 1.
+func (s *Screen) MoveTo(row, col int) error {
+	return s.write(fmt.Sprintf("%s[%d;%dH", esc, max(row, 1), max(col, 1)))
+}
+
+// ClearLine clears the line the cursor is on and moves the cursor to its start.
+func (s *Screen) ClearLine() error {
+	return s.write("\r" + esc + "[2K")
+}
+
+// ClearLines clears the line the cursor is on and the n-1 lines above it,
+// leaving the cursor at the start of the topmost one. Use it to redraw output
+// that spans several lines.
+func (s *Screen) ClearLines(n int) error {
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			if err := s.MoveUp(1); err != nil {
+				return err
+			}
+		}
+		if err := s.ClearLine(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClearScreen clears the whole screen and moves the cursor to the top left.
+func (s *Screen) ClearScreen() error {
+	return s.write(esc + "[2J" + esc + "[H")
+}
+
+// EnterAltScreen switches to the alternate screen buffer, the screen the user
+// was looking at comes back with ExitAltScreen.
+func (s *Screen) EnterAltScreen() error {
+	return s.write(esc + "[?1049h")
+}
+
+// ExitAltScreen switches back to the main screen buffer.
+func (s *Screen) ExitAltScreen() error {
+	return s.write(esc + "[?1049l")
+}
+
+// OnResize calls fn with the new size whenever the terminal is resized, until
+// the returned func is called. It is a no-op when the Screen is not a terminal.
+func (s *Screen) OnResize(fn func(width, height int)) (stop func()) {
+	if !s.tty {
+		return func() {}
+	}
+
+	resized, stopNotify := notifyResize(s)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-resized:
+				fn(s.Size())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		stopNotify()
+		close(done)
+	}
+}
@@ -0,0 +1,67 @@
+//go:build !windows
+
+package screen
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestScreen(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(s *Screen) error
+		want string
+	}{
+		{"hide cursor", (*Screen).HideCursor, "\033[?25l"},
+		{"show cursor", (*Screen).ShowCursor, "\033[?25h"},
+		{"save cursor", (*Screen).SaveCursor, "\0337"},
+		{"restore cursor", (*Screen).RestoreCursor, "\0338"},
+		{"move up", func(s *Screen) error { return s.MoveUp(3) }, "\033[3A"},
+		{"move down", func(s *Screen) error { return s.MoveDown(1) }, "\033[1B"},
+		{"move right", func(s *Screen) error { return s.MoveRight(2) }, "\033[2C"},
+		{"move left", func(s *Screen) error { return s.MoveLeft(4) }, "\033[4D"},
+		{"move zero", func(s *Screen) error { return s.MoveUp(0) }, ""},
+		{"move to", func(s *Screen) error { return s.MoveTo(2, 10) }, "\033[2;10H"},
+		{"clear line", (*Screen).ClearLine, "\r\033[2K"},
+		{"clear lines", func(s *Screen) error { return s.ClearLines(2) }, "\r\033[2K\033[1A\r\033[2K"},
+		{"clear screen", (*Screen).ClearScreen, "\033[2J\033[H"},
+		{"enter alt screen", (*Screen).EnterAltScreen, "\033[?1049h"},
+		{"exit alt screen", (*Screen).ExitAltScreen, "\033[?1049l"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			if err := tt.fn(NewTTY(&buf)); err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("wrote %q, want %q", buf.String(), tt.want)
+			}
+
+			// writers that are not a terminal get nothing
+			buf.Reset()
+			if err := tt.fn(New(&buf)); err != nil || buf.Len() > 0 {
+				t.Errorf("not a tty wrote %q, error = %v", buf.String(), err)
+			}
+		})
+	}
+}
+
+func TestOnResize(t *testing.T) {
+	resized := make(chan struct{}, 1)
+	stop := NewTTY(&bytes.Buffer{}).OnResize(func(width, height int) {
+		resized <- struct{}{}
+	})
+	defer stop()
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGWINCH)
+	select {
+	case <-resized:
+	case <-time.After(time.Second):
+		t.Error("OnResize() callback not called after SIGWINCH")
+	}
+}
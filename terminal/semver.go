@@ -0,0 +1,173 @@
+package terminal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// versionPattern finds the first version in a tool's output, like "v1.29.2"
+// in "Client Version: v1.29.2".
+var versionPattern = regexp.MustCompile(`v?(\d+)\.(\d+)(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?`)
+
+// version is a parsed semantic version.
+type version struct {
+	major, minor, patch int
+	pre                 string
+	// parts is how many of major, minor and patch were given.
+	parts int
+}
+
+// parseVersion parses "1", "1.2", "v1.2.3" or "1.2.3-rc.1".
+func parseVersion(s string) (version, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	core, pre, _ := strings.Cut(s, "-")
+	core, _, _ = strings.Cut(core, "+")
+
+	v := version{pre: pre}
+	fields := strings.Split(core, ".")
+	if len(fields) > 3 {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		switch i {
+		case 0:
+			v.major = n
+		case 1:
+			v.minor = n
+		case 2:
+			v.patch = n
+		}
+	}
+	v.parts = len(fields)
+	return v, nil
+}
+
+func (v version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	if v.pre != "" {
+		s += "-" + v.pre
+	}
+	return s
+}
+
+// compare returns -1, 0 or 1. A pre-release sorts before its release.
+func (v version) compare(o version) int {
+	for _, d := range []int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		switch {
+		case d < 0:
+			return -1
+		case d > 0:
+			return 1
+		}
+	}
+
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	case v.pre < o.pre:
+		return -1
+	}
+	return 1
+}
+
+// comparatorPattern splits a single comparison like ">=1.2" or "^2".
+var comparatorPattern = regexp.MustCompile(`^(>=|<=|!=|==|=|>|<|\^|~)?\s*(v?[0-9][0-9A-Za-z.+-]*)$`)
+
+// satisfies reports whether v matches constraint. A constraint is a list of
+// comparisons that must all match, for example ">=1.2 <2" or ">=1.2, <2",
+// and alternatives can be joined with "||". "^1.2" allows changes that keep the
+// major version (the minor version for 0.x), "~1.2" allows patch changes.
+func satisfies(v version, constraint string) (bool, error) {
+	for _, alternative := range strings.Split(constraint, "||") {
+		ok, err := satisfiesAll(v, alternative)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func satisfiesAll(v version, constraint string) (bool, error) {
+	fields := strings.Fields(strings.ReplaceAll(constraint, ",", " "))
+	if len(fields) == 0 {
+		return false, fmt.Errorf("invalid version constraint %q", constraint)
+	}
+
+	// join operators written apart from their version, like ">= 1.2"
+	comparisons := []string{}
+	for i := 0; i < len(fields); i++ {
+		if strings.Trim(fields[i], "<>=!^~") == "" && i+1 < len(fields) {
+			comparisons = append(comparisons, fields[i]+fields[i+1])
+			i++
+			continue
+		}
+		comparisons = append(comparisons, fields[i])
+	}
+
+	for _, comparison := range comparisons {
+		ok, err := compareVersion(v, comparison)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func compareVersion(v version, comparison string) (bool, error) {
+	m := comparatorPattern.FindStringSubmatch(comparison)
+	if m == nil {
+		return false, fmt.Errorf("invalid version constraint %q", comparison)
+	}
+	want, err := parseVersion(m[2])
+	if err != nil {
+		return false, fmt.Errorf("invalid version constraint %q: %w", comparison, err)
+	}
+
+	c := v.compare(want)
+	switch m[1] {
+	case ">=":
+		return c >= 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case "<":
+		return c < 0, nil
+	case "!=":
+		return c != 0, nil
+	case "^":
+		return c >= 0 && v.compare(caretLimit(want)) < 0, nil
+	case "~":
+		return c >= 0 && v.compare(tildeLimit(want)) < 0, nil
+	}
+	return c == 0, nil
+}
+
+// caretLimit is the first version excluded by "^want".
+func caretLimit(want version) version {
+	switch {
+	case want.major > 0 || want.parts == 1:
+		return version{major: want.major + 1}
+	case want.minor > 0 || want.parts == 2:
+		return version{minor: want.minor + 1}
+	}
+	return version{patch: want.patch + 1}
+}
+
+// tildeLimit is the first version excluded by "~want".
+func tildeLimit(want version) version {
+	if want.parts == 1 {
+		return version{major: want.major + 1}
+	}
+	return version{major: want.major, minor: want.minor + 1}
+}
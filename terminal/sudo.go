@@ -0,0 +1,83 @@
+package terminal
+
+import (
+	"context"
+	"io"
+	"os/user"
+	"strings"
+
+	"github.com/mcsteele8/common-cli-utils/xprompt"
+)
+
+// promptPassword asks the user for their sudo password with masked input.
+var promptPassword = func(message string) string {
+	return xprompt.Prompt(message, xprompt.PromptOptions{MaskInput: true})
+}
+
+// SudoNeedsPassword reports whether sudo would prompt for a password, checked
+// with "sudo -n true". It returns true if sudo is not installed.
+func SudoNeedsPassword(ctx context.Context) bool {
+	return sudoNeedsPassword(ctx, &RunCmdOptions{})
+}
+
+func sudoNeedsPassword(ctx context.Context, opt *RunCmdOptions) bool {
+	_, err := executorFor(opt).Execute(ctx, Command("sudo", "-n", "true"), &RunCmdOptions{})
+	return err != nil
+}
+
+// RunSudo runs c with sudo. If sudo needs a password the user is prompted for it
+// with masked input and the password is passed to sudo on stdin, so the command
+// itself never sees a terminal prompt and its output can still be captured.
+func RunSudo(ctx context.Context, c *Cmd, opt *RunCmdOptions) (*Result, error) {
+	sudoOpt := RunCmdOptions{}
+	if opt != nil {
+		sudoOpt = *opt
+	}
+
+	args := []string{"-n"}
+	if isDryRun(&sudoOpt) {
+		// nothing runs, so there is no need to probe sudo or ask for a password
+		args = nil
+	} else if sudoNeedsPassword(ctx, &sudoOpt) {
+		password := promptPassword(sudoPasswordMessage())
+		// -S reads the password from stdin and -p "" hides sudo's own prompt
+		args = []string{"-S", "-p", ""}
+		sudoOpt.Interactive = false
+		// the password goes first, anything after it is read by the command
+		if sudoOpt.Input == nil && sudoOpt.Stdin != nil {
+			sudoOpt.Stdin = io.MultiReader(strings.NewReader(password+"\n"), sudoOpt.Stdin)
+		} else {
+			// Input is replayed on every retry attempt, the password with it
+			sudoOpt.Input = append([]byte(password+"\n"), sudoOpt.Input...)
+		}
+	}
+
+	sudoCmd, cleanup, err := sudoCommand(c, args, sudoOpt.Shell)
+	defer cleanup()
+	if err != nil {
+		res := &Result{Command: c.String(), ExitCode: -1}
+		return res, &ExitError{Result: res, Err: err}
+	}
+	return Exec(ctx, sudoCmd, &sudoOpt)
+}
+
+// sudoCommand wraps c in a sudo invocation with the given sudo flags. Scripts
+// run with the same shell and arguments as without sudo, the returned func
+// removes the script file of InFile scripts once the command has exited.
+func sudoCommand(c *Cmd, sudoArgs []string, shell string) (*Cmd, func(), error) {
+	args := append(append([]string{}, sudoArgs...), "--")
+	if c.Script == "" {
+		args = append(append(args, c.Name), c.Args...)
+		return Command("sudo", args...), func() {}, nil
+	}
+
+	argv, cleanup, err := c.shellArgv(shell)
+	return Command("sudo", append(args, argv...)...), cleanup, err
+}
+
+func sudoPasswordMessage() string {
+	if u, err := user.Current(); err == nil {
+		return "[sudo] password for " + u.Username
+	}
+	return "[sudo] password"
+}
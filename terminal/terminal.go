@@ -4,140 +4,278 @@ import (
 	"bytes"
 	"context"
 	"errors"
-	"fmt"
 	"io"
 	"os"
 	"os/exec"
-	"strings"
+	"sync"
 	"time"
 )
 
+const defaultGracePeriod = 5 * time.Second
+
 type RunCmdOptions struct {
 	Cwd        string
 	Env        []string
 	ShowOutput bool
 	CtxTimeout time.Duration
+	// CleanEnv starts the command with an empty environment instead of ours.
+	CleanEnv bool
+	// InheritEnv starts the command with only these variables from our
+	// environment. A trailing "*" matches a prefix, for example "AWS_*".
+	InheritEnv []string
+	// UnsetEnv removes these variables from the command's environment.
+	UnsetEnv []string
+	// GracePeriod is how long a cancelled command gets to exit after SIGTERM
+	// before it is killed. Defaults to 5 seconds.
+	GracePeriod time.Duration
+	// ProcessGroup runs the command in its own process group so cancelling it
+	// also stops everything the command started. The command then no longer
+	// gets Ctrl-C from the terminal and is stopped if it reads from it, so only
+	// use it for commands that never prompt. Without a controlling terminal,
+	// as in CI, commands always get their own group. Ignored on windows.
+	ProcessGroup bool
+	// Shell runs scripts, including the ones given to RunCommand, with this
+	// shell instead of /bin/sh, unless Cmd.Shell is set.
+	Shell string
+	// Interactive attaches the terminal's stdin so the command can prompt the
+	// user. Without ShowOutput stdout and stderr are captured combined.
+	Interactive bool
+	// RunInPTY runs the command attached to a pseudo-terminal so tools that check
+	// for a TTY keep their colors and prompts. Only supported on Linux. Stdout and
+	// stderr are merged into Result.Stdout.
+	RunInPTY bool
+
+	// Redact masks secrets in the echoed command, output and errors, see
+	// Redactor. SetRedactor adds secrets for every command.
+	Redact *Redactor
+	// CaptureLimit caps how much output is kept in the Result, see CaptureLimit.
+	CaptureLimit *CaptureLimit
+
+	// Stdout and Stderr receive a copy of the command's output as it is written.
+	Stdout io.Writer
+	Stderr io.Writer
+	// OnStdoutLine and OnStderrLine are called with every line of output, without
+	// the trailing newline. Calls for one command never run concurrently.
+	OnStdoutLine func(line string)
+	OnStderrLine func(line string)
+	// Prefix is prepended to every line streamed to the terminal, Stdout and
+	// Stderr, for example "[build] ". PrefixColor optionally colors it, for
+	// example color.Cyan.Paint.
+	Prefix      string
+	PrefixColor func(string) string
+	// Retry reruns the command when it fails, see RetryPolicy.
+	Retry *RetryPolicy
+	// DryRun prints the command, its working directory and environment changes
+	// instead of running it. SetDryRun enables it for every command.
+	DryRun bool
+	// Recorder records this command in addition to any session recorder set
+	// with SetRecorder.
+	Recorder *Recorder
+	// ShowEnvValues includes the values of environment variables in the
+	// dry-run output and in records, by default they show as KEY=<set>.
+	ShowEnvValues bool
+	// Executor runs this command instead of the one set with SetExecutor.
+	Executor Executor
+	// Input is written to the command's stdin, for example a manifest piped
+	// into "kubectl apply -f -". It is replayed on every retry attempt.
+	Input []byte
+	// Stdin is read into the command's stdin when Input is not set. A reader
+	// can only be consumed once, so retries after the first attempt get an
+	// empty stdin. Either one replaces the terminal's stdin for Interactive.
+	Stdin io.Reader
+}
+
+// stdinReader returns the reader the command's stdin is fed from, nil if
+// neither Input nor Stdin is set.
+func stdinReader(opt *RunCmdOptions) io.Reader {
+	if opt.Input != nil {
+		return bytes.NewReader(opt.Input)
+	}
+	return opt.Stdin
 }
 
 // RunCommand runs the given script, streaming stdout and stderr to the
-// terminal and capturing exit error results in the returned results.
+// terminal and capturing exit error results in the returned results. A sudo
+// in the script asks for the password on the terminal, RunSudo asks for it
+// itself and also works without a terminal.
 func RunCommand(script string, opt *RunCmdOptions) ([]byte, error) {
-	ctx := context.Background()
-	var cancel context.CancelFunc
-	if opt.CtxTimeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, opt.CtxTimeout)
-		defer cancel()
-	}
+	return RunCommandContext(context.Background(), script, opt)
+}
 
-	if containsSudo(script) {
-		return RunCmdAndExpectUserInput(script, opt)
-	}
+// RunCommandContext runs the given script like RunCommand. When ctx is cancelled
+// or opt.CtxTimeout expires the script is sent SIGTERM and, if it is still
+// running after opt.GracePeriod, SIGKILL. Everything the script started is
+// signalled too when it runs in its own process group, see opt.ProcessGroup.
+func RunCommandContext(ctx context.Context, script string, opt *RunCmdOptions) ([]byte, error) {
+	return RunCmd(ctx, ShellCommand(script), opt)
+}
 
+// runCaptured runs c, capturing stdout and stderr and streaming them to the
+// terminal when opt.ShowOutput is set.
+func runCaptured(ctx context.Context, c *Cmd, opt *RunCmdOptions) (*Result, error) {
 	if opt.ShowOutput {
-		fmt.Printf("running script: %s\n", script)
+		printRunning(opt, "running script", c.String())
 	}
 
-	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", script)
-
-	// make sure the script runs with the current environment
-	// this allows things like PATH setting to work accoss shells
-	cmd.Env = os.Environ()
-
-	if len(opt.Env) > 0 {
-		cmd.Env = append(cmd.Env, opt.Env...)
+	cmd, cleanup := newExecCmd(ctx, c, opt)
+	defer cleanup()
+	if ownProcessGroup(opt) {
+		setProcessGroup(cmd)
 	}
 
-	if opt.Cwd != "" {
-		cmd.Dir = opt.Cwd
-	}
+	results := newCapture(opt)
+	detailedErr := newCapture(opt)
+	out := newStreams(opt, results, detailedErr)
+	cmd.Stdout = out.stdout
+	cmd.Stderr = out.stderr
+	cmd.Stdin = stdinReader(opt)
 
-	if opt.ShowOutput {
-		results := bytes.Buffer{}
-		cmd.Stdout = io.MultiWriter(&results, os.Stdout)
+	start := time.Now()
+	err := runCmd(cmd, opt)
+	out.flush()
 
-		detailedErr := bytes.Buffer{}
-		cmd.Stderr = io.MultiWriter(os.Stderr, &detailedErr)
+	res, err := newResult(ctx, c, cmd, start, results.Bytes(), detailedErr.Bytes(), err)
+	res.Truncated = truncated(results, detailedErr)
+	return res, err
+}
 
-		err := cmd.Run()
-		if err != nil {
-			return results.Bytes(), doErr(err, script, detailedErr.String())
-		}
-		return results.Bytes(), nil
+// RunCmdAndExpectUserInput runs the given script with RunCmdOptions.Interactive
+// set. The script is stopped after one minute unless opt.CtxTimeout is set.
+func RunCmdAndExpectUserInput(script string, opt *RunCmdOptions) ([]byte, error) {
+	interactiveOpt := RunCmdOptions{}
+	if opt != nil {
+		interactiveOpt = *opt
 	}
-	results := bytes.Buffer{}
-	cmd.Stdout = &results
-	detailedErr := bytes.Buffer{}
-	cmd.Stderr = io.MultiWriter(&detailedErr)
-
-	err := cmd.Run()
-	if err != nil {
-		return nil, doErr(err, script, detailedErr.String())
+	if interactiveOpt.CtxTimeout <= 0 {
+		interactiveOpt.CtxTimeout = time.Minute
 	}
 
-	return results.Bytes(), nil
+	return RunCmdContextAndExpectUserInput(context.Background(), script, &interactiveOpt)
 }
 
-func RunCmdAndExpectUserInput(script string, opt *RunCmdOptions) ([]byte, error) {
-	if opt.CtxTimeout <= 0 {
-		opt.CtxTimeout = time.Minute
+// RunCmdContextAndExpectUserInput runs the given script with RunCmdOptions.Interactive set.
+func RunCmdContextAndExpectUserInput(ctx context.Context, script string, opt *RunCmdOptions) ([]byte, error) {
+	interactiveOpt := RunCmdOptions{}
+	if opt != nil {
+		interactiveOpt = *opt
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), opt.CtxTimeout)
-	defer cancel()
+	interactiveOpt.Interactive = true
 
-	return RunCmdContextAndExpectUserInput(ctx, script, opt)
+	return RunCmd(ctx, ShellCommand(script), &interactiveOpt)
 }
 
-func RunCmdContextAndExpectUserInput(ctx context.Context, script string, opt *RunCmdOptions) ([]byte, error) {
+// runInteractive runs c with the terminal's stdin attached so it can prompt the
+// user. The command stays in our process group so it can read from the
+// terminal. Without opt.ShowOutput stdout and stderr are captured combined in
+// Result.Stdout.
+func runInteractive(ctx context.Context, c *Cmd, opt *RunCmdOptions) (*Result, error) {
 	if opt.ShowOutput {
-		fmt.Printf("Running: %s\n", script)
+		printRunning(opt, "Running", c.String())
 	}
-	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", script)
+	cmd, cleanup := newExecCmd(ctx, c, opt)
+	defer cleanup()
 	cmd.Stdin = os.Stdin // This will cause the command to pause if there is a prompt waiting for stdin
+	if stdin := stdinReader(opt); stdin != nil {
+		cmd.Stdin = stdin
+	}
 
-	cmd.Env = os.Environ()
-
-	if len(opt.Env) > 0 {
-		cmd.Env = append(cmd.Env, opt.Env...)
+	combined := newCapture(opt)
+	detailedErr := newCapture(opt)
+	var out *streams
+	if opt.ShowOutput {
+		// leave stdout uncaptured so the command writes straight to the terminal
+		out = newStreams(opt, nil, detailedErr)
+	} else {
+		// stdout and stderr are copied by separate goroutines
+		shared := &lockedWriter{mu: &sync.Mutex{}, w: combined}
+		out = newStreams(opt, shared, io.MultiWriter(shared, detailedErr))
 	}
+	cmd.Stdout = out.stdout
+	cmd.Stderr = out.stderr
+
+	start := time.Now()
+	err := runCmd(cmd, opt)
+	out.flush()
+
+	res, err := newResult(ctx, c, cmd, start, combined.Bytes(), detailedErr.Bytes(), err)
+	res.Truncated = truncated(combined, detailedErr)
+	return res, err
+}
+
+// newExecCmd builds the exec.Cmd for c with the shell, working directory and
+// environment from opt applied. The returned func must be called once the
+// command has exited.
+func newExecCmd(ctx context.Context, c *Cmd, opt *RunCmdOptions) (*exec.Cmd, func()) {
+	cmd, cleanup := c.execCmd(ctx, opt.Shell)
+
+	// make sure the script runs with the current environment
+	// this allows things like PATH setting to work accoss shells
+	cmd.Env = buildEnv(opt)
 
 	if opt.Cwd != "" {
 		cmd.Dir = opt.Cwd
 	}
 
-	if opt.ShowOutput {
-		cmd.Stdout = os.Stdout
-
-		detailedErr := bytes.Buffer{}
-		cmd.Stderr = io.MultiWriter(os.Stderr, &detailedErr)
+	return cmd, cleanup
+}
 
-		err := cmd.Run()
-		if err != nil {
-			return nil, doErr(err, script, detailedErr.String())
-		}
-		return nil, nil
-	}
+// runCmd runs cmd. If its context is cancelled the process is asked to stop
+// with SIGTERM and is killed if it is still running after opt.GracePeriod.
+func runCmd(cmd *exec.Cmd, opt *RunCmdOptions) error {
+	exited := gracefulCancel(cmd, opt)
+	defer exited()
 
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return nil, doErr(err, script, string(out))
+	if err := cmd.Start(); err != nil {
+		return err
 	}
+	untrack := track(cmd)
+	defer untrack()
 
-	return out, nil
+	return waitCmd(cmd)
 }
 
-func containsSudo(script string) bool {
-	return strings.Contains(script, "sudo")
+// waitCmd waits for cmd to exit. A command that exited cleanly while a
+// background child kept its output open past the wait delay has not failed,
+// only the child's later output is lost.
+func waitCmd(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		return nil
+	}
+	return err
 }
 
-func isSignalInterrupt(err error) bool {
-	return strings.Contains(err.Error(), "signal: interrupt")
+// ownProcessGroup reports whether a captured command runs in its own process
+// group. At a terminal it stays in ours, so Ctrl-C reaches it and it can
+// prompt on /dev/tty.
+func ownProcessGroup(opt *RunCmdOptions) bool {
+	return opt.ProcessGroup || noTerminal()
 }
 
-func doErr(err error, script, message string) error {
-	if err != nil && isSignalInterrupt(err) {
-		return fmt.Errorf("failed to run script -> %s | error code: %s | error message: %s", script, err.Error(), message)
-	} else if err != nil && !errors.Is(err, io.ErrShortWrite) {
-		return fmt.Errorf("failed to run script -> %s | error code: %s | error message: %s", script, err.Error(), message)
+// gracefulCancel makes cancelling cmd's context send SIGTERM, followed by
+// SIGKILL after opt.GracePeriod. Wait gives up on the output pipes after the
+// same period, so a child that escaped the signals cannot block it. The
+// returned func must be called once cmd has exited.
+func gracefulCancel(cmd *exec.Cmd, opt *RunCmdOptions) func() {
+	gracePeriod := opt.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = defaultGracePeriod
+	}
+
+	exited := make(chan struct{})
+	cmd.WaitDelay = gracePeriod
+	cmd.Cancel = func() error {
+		go func() {
+			select {
+			case <-time.After(gracePeriod):
+				killProcess(cmd)
+			case <-exited:
+			}
+		}()
+		return terminateProcess(cmd)
+	}
+
+	return func() {
+		close(exited)
 	}
-	return nil
 }
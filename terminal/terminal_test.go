@@ -0,0 +1,1175 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		opt     *RunCmdOptions
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "stdout_is_returned",
+			script: "echo hello",
+			opt:    &RunCmdOptions{},
+			want:   "hello\n",
+		},
+		{
+			name:   "env_and_cwd_are_applied",
+			script: "echo $TERMINAL_TEST_VALUE; pwd",
+			opt:    &RunCmdOptions{Env: []string{"TERMINAL_TEST_VALUE=value"}, Cwd: "/"},
+			want:   "value\n/\n",
+		},
+		{
+			name:    "non_zero_exit_returns_error",
+			script:  "echo failed >&2; exit 3",
+			opt:     nil,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RunCommand(tt.script, tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("RunCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunCommandContextCancel(t *testing.T) {
+	tests := []struct {
+		name        string
+		script      string
+		interactive bool
+	}{
+		{
+			name:   "terminated_with_sigterm",
+			script: "sleep 10 & wait",
+		},
+		{
+			name:   "killed_after_grace_period",
+			script: "trap '' TERM; sleep 10 & wait",
+		},
+		{
+			// interactive commands share our process group, the signals only
+			// reach the shell while sleep keeps the output pipe open
+			name:        "interactive_child_holding_output",
+			script:      "sleep 4; echo done",
+			interactive: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			_, err := RunCommandContext(ctx, tt.script, &RunCmdOptions{GracePeriod: 200 * time.Millisecond, Interactive: tt.interactive})
+			if err == nil {
+				t.Fatalf("RunCommandContext() expected an error after cancel")
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("RunCommandContext() took %v, the process group was not stopped", elapsed)
+			}
+			if !strings.Contains(err.Error(), "signal") {
+				t.Errorf("RunCommandContext() error = %v, want a signal error", err)
+			}
+		})
+	}
+}
+
+// TestRunCommandAtTerminal runs commands from a child test binary attached to
+// a pseudo-terminal, like a CLI started from a shell. The commands stay in its
+// process group, so they can prompt on /dev/tty and Ctrl-C stops them.
+func TestRunCommandAtTerminal(t *testing.T) {
+	switch os.Getenv("TERMINAL_TEST_TTY_HELPER") {
+	case "prompt":
+		out, err := RunCommand("read x < /dev/tty; echo got=$x", nil)
+		fmt.Printf("%s%v\n", out, err)
+		return
+	case "interrupt":
+		RunCommand("echo $$ > "+Quote(os.Getenv("TERMINAL_TEST_PIDFILE"))+"; exec sleep 30", nil)
+		return
+	}
+
+	startCLI := func(t *testing.T, helper string, env ...string) (*exec.Cmd, *os.File) {
+		master, slave, err := openPTY()
+		if err != nil {
+			t.Skip(err)
+		}
+		t.Cleanup(func() { master.Close() })
+		cli := exec.Command(os.Args[0], "-test.run=^TestRunCommandAtTerminal$")
+		cli.Env = append(append(os.Environ(), "TERMINAL_TEST_TTY_HELPER="+helper), env...)
+		cli.Stdin, cli.Stdout, cli.Stderr = slave, slave, slave
+		setControllingTTY(cli)
+		if err := cli.Start(); err != nil {
+			t.Fatal(err)
+		}
+		slave.Close()
+		t.Cleanup(func() { cli.Process.Kill(); cli.Wait() })
+		return cli, master
+	}
+
+	t.Run("prompt_on_tty", func(t *testing.T) {
+		cli, master := startCLI(t, "prompt")
+		output := make(chan string, 1)
+		go func() {
+			out, _ := io.ReadAll(master)
+			output <- string(out)
+		}()
+		master.Write([]byte("secret\n"))
+
+		done := make(chan struct{})
+		go func() { cli.Wait(); close(done) }()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the command reading /dev/tty hung")
+		}
+		if out := <-output; !strings.Contains(out, "got=secret\r\n<nil>") {
+			t.Errorf("output = %q, want got=secret", out)
+		}
+	})
+
+	t.Run("ctrl_c", func(t *testing.T) {
+		pidFile := filepath.Join(t.TempDir(), "pid")
+		cli, master := startCLI(t, "interrupt", "TERMINAL_TEST_PIDFILE="+pidFile)
+		go io.Copy(io.Discard, master)
+
+		var pid int
+		for deadline := time.Now().Add(5 * time.Second); pid == 0 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			data, _ := os.ReadFile(pidFile)
+			pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		}
+		if pid == 0 {
+			t.Fatal("the command never started")
+		}
+
+		// the terminal turns ^C into SIGINT for its foreground process group
+		master.Write([]byte{3})
+		cli.Wait()
+		for deadline := time.Now().Add(2 * time.Second); syscall.Kill(pid, 0) == nil; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				syscall.Kill(pid, syscall.SIGKILL)
+				t.Fatalf("command %d kept running after Ctrl-C", pid)
+			}
+		}
+	})
+}
+
+func TestRunCmd(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  *Cmd
+		want string
+	}{
+		{
+			name: "args_are_not_shell_processed",
+			cmd:  Command("echo", "$HOME; rm -rf /", "a  b"),
+			want: "$HOME; rm -rf / a  b\n",
+		},
+		{
+			name: "shell_command_opt_in",
+			cmd:  ShellCommand("echo " + Quote("it's $HOME") + " | tr a-z A-Z"),
+			want: "IT'S $HOME\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RunCmd(context.Background(), tt.cmd, nil)
+			if err != nil {
+				t.Fatalf("RunCmd() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("RunCmd() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "''"},
+		{"simple-value_1.txt", "simple-value_1.txt"},
+		{"two words", "'two words'"},
+		{"it's", `'it'\''s'`},
+		{"$(whoami)", "'$(whoami)'"},
+	}
+
+	for _, tt := range tests {
+		if got := Quote(tt.in); got != tt.want {
+			t.Errorf("Quote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	if got := Command("kubectl", "get", "pods", "-l", "app=my app").String(); got != "kubectl get pods -l 'app=my app'" {
+		t.Errorf("Cmd.String() = %s", got)
+	}
+}
+
+func TestExec(t *testing.T) {
+	res, err := Exec(context.Background(), ShellCommand("echo out; echo err >&2; exit 3"), nil)
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Exec() error = %v, want *ExitError", err)
+	}
+	if exitErr.ExitCode != 3 || res.ExitCode != 3 {
+		t.Errorf("Exec() exit code = %d, want 3", exitErr.ExitCode)
+	}
+	if string(res.Stdout) != "out\n" || string(res.Stderr) != "err\n" {
+		t.Errorf("Exec() stdout = %q, stderr = %q", res.Stdout, res.Stderr)
+	}
+	if res.Signal != nil || res.TimedOut {
+		t.Errorf("Exec() signal = %v, timed out = %v", res.Signal, res.TimedOut)
+	}
+
+	res, err = Exec(context.Background(), Command("sleep", "5"), &RunCmdOptions{CtxTimeout: 50 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Exec() error = %v, want context.DeadlineExceeded", err)
+	}
+	if !res.TimedOut || res.Signal != syscall.SIGTERM || res.ExitCode != -1 {
+		t.Errorf("Exec() timed out = %v, signal = %v, exit code = %d", res.TimedOut, res.Signal, res.ExitCode)
+	}
+}
+
+func TestSudoCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		cmd   *Cmd
+		args  []string
+		shell string
+		want  string
+	}{
+		{
+			name: "argv_command",
+			cmd:  Command("apt-get", "install", "-y", "jq"),
+			args: []string{"-n"},
+			want: "sudo -n -- apt-get install -y jq",
+		},
+		{
+			name: "shell_command_with_password_on_stdin",
+			cmd:  ShellCommand("echo pseudocode > /etc/motd"),
+			args: []string{"-S", "-p", ""},
+			want: "sudo -S -p '' -- /bin/sh -c 'echo pseudocode > /etc/motd'",
+		},
+		{
+			name:  "option_shell",
+			cmd:   ShellCommand("echo $0"),
+			args:  []string{"-n"},
+			shell: "bash",
+			want:  "sudo -n -- bash -c 'echo $0'",
+		},
+		{
+			name:  "cmd_shell_and_script_args",
+			cmd:   &Cmd{Script: `chown "$1" /srv`, Shell: "zsh", ScriptArgs: []string{"deploy user"}},
+			args:  []string{"-n"},
+			shell: "bash",
+			want:  "sudo -n -- zsh -c 'chown \"$1\" /srv' zsh 'deploy user'",
+		},
+		{
+			name: "strict",
+			cmd:  &Cmd{Script: "false", Strict: true},
+			args: []string{"-n"},
+			want: "sudo -n -- /bin/sh -c " + Quote(strictPrelude+"false"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, cleanup, err := sudoCommand(tt.cmd, tt.args, tt.shell)
+			defer cleanup()
+			if err != nil {
+				t.Fatalf("sudoCommand() error = %v", err)
+			}
+			if got := c.String(); got != tt.want {
+				t.Errorf("sudoCommand() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// InFile scripts run from a file that is removed by cleanup
+	c, cleanup, err := sudoCommand(&Cmd{Script: "echo hi", InFile: true, ScriptArgs: []string{"a"}}, []string{"-n"}, "")
+	if err != nil {
+		t.Fatalf("sudoCommand() InFile error = %v", err)
+	}
+	path := c.Args[3]
+	if got := strings.Join(c.Args, " "); got != "-n -- /bin/sh "+path+" a" {
+		t.Errorf("sudoCommand() InFile args = %q", got)
+	}
+	if script, err := os.ReadFile(path); err != nil || string(script) != "echo hi" {
+		t.Errorf("script file = %q, %v", script, err)
+	}
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("script file %s not removed, error = %v", path, err)
+	}
+
+	// scripts mentioning sudo are no longer rerouted to an interactive run
+	got, err := RunCommand("echo pseudocode", nil)
+	if err != nil || string(got) != "pseudocode\n" {
+		t.Errorf("RunCommand() = %q, %v", got, err)
+	}
+}
+
+// sudoExecutor fails the sudo password probe and the first run of every other
+// command, recording what each run read from stdin.
+type sudoExecutor struct {
+	stdins []string
+}
+
+func (e *sudoExecutor) Execute(ctx context.Context, c *Cmd, opt *RunCmdOptions) (*Result, error) {
+	res := &Result{Command: c.String()}
+	if c.String() != "sudo -n true" {
+		in, _ := io.ReadAll(stdinReader(opt))
+		e.stdins = append(e.stdins, string(in))
+		if len(e.stdins) > 1 {
+			return res, nil
+		}
+	}
+	res.ExitCode = 1
+	return res, &ExitError{Result: res, Err: errors.New("exit status 1")}
+}
+
+func TestRunSudoPasswordRetry(t *testing.T) {
+	prompt := promptPassword
+	promptPassword = func(string) string { return "hunter2" }
+	defer func() { promptPassword = prompt }()
+
+	exe := &sudoExecutor{}
+	_, err := RunSudo(context.Background(), Command("apt-get", "install", "jq"), &RunCmdOptions{
+		Executor: exe,
+		Input:    []byte("y\n"),
+		Retry:    &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("RunSudo() error = %v", err)
+	}
+	// every attempt gets the password followed by the caller's input
+	if strings.Join(exe.stdins, "|") != "hunter2\ny\n|hunter2\ny\n" {
+		t.Errorf("stdin per attempt = %q", exe.stdins)
+	}
+}
+
+// failingExecutor fails every command without returning a Result.
+type failingExecutor struct{}
+
+func (failingExecutor) Execute(context.Context, *Cmd, *RunCmdOptions) (*Result, error) {
+	return nil, errors.New("executor failed")
+}
+
+func TestExecNilResult(t *testing.T) {
+	opt := &RunCmdOptions{Executor: failingExecutor{}, Retry: &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}}
+	res, err := Exec(context.Background(), Command("echo", "hi"), opt)
+	if err == nil {
+		t.Fatal("Exec() error = nil")
+	}
+	if res == nil || res.Command != "echo hi" || res.ExitCode != -1 {
+		t.Errorf("Exec() result = %+v", res)
+	}
+
+	pres, err := RunPipeline(context.Background(), []*Cmd{Command("echo", "hi"), Command("cat")}, &RunCmdOptions{Executor: failingExecutor{}})
+	if err == nil {
+		t.Fatal("RunPipeline() error = nil")
+	}
+	if len(pres.Stages) != 2 || pres.Stages[0].ExitCode != -1 {
+		t.Errorf("RunPipeline() stages = %+v", pres.Stages)
+	}
+}
+
+func TestExecRunInPTY(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("pty support is linux only")
+	}
+
+	res, err := Exec(context.Background(), ShellCommand("test -t 1 && echo tty; echo err >&2"), &RunCmdOptions{RunInPTY: true})
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	// the pty translates newlines to CRLF
+	if string(res.Stdout) != "tty\r\nerr\r\n" {
+		t.Errorf("Exec() transcript = %q", res.Stdout)
+	}
+
+	res, err = Exec(context.Background(), ShellCommand("exit 4"), &RunCmdOptions{RunInPTY: true})
+	if err == nil || res.ExitCode != 4 {
+		t.Errorf("Exec() exit code = %d, error = %v", res.ExitCode, err)
+	}
+}
+
+func TestExecStreaming(t *testing.T) {
+	var stdoutLines, stderrLines []string
+	prefixed := bytes.Buffer{}
+
+	res, err := Exec(context.Background(), ShellCommand("echo one; echo two >&2; printf three"), &RunCmdOptions{
+		Stdout:       &prefixed,
+		Stderr:       &prefixed,
+		OnStdoutLine: func(line string) { stdoutLines = append(stdoutLines, line) },
+		OnStderrLine: func(line string) { stderrLines = append(stderrLines, line) },
+		Prefix:       "[build] ",
+		PrefixColor:  func(s string) string { return "<" + s + ">" },
+	})
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+
+	if string(res.Stdout) != "one\nthree" {
+		t.Errorf("Exec() stdout = %q", res.Stdout)
+	}
+	if strings.Join(stdoutLines, ",") != "one,three" || strings.Join(stderrLines, ",") != "two" {
+		t.Errorf("Exec() stdout lines = %q, stderr lines = %q", stdoutLines, stderrLines)
+	}
+	for _, want := range []string{"<[build] >one\n", "<[build] >two\n", "<[build] >three\n"} {
+		if !strings.Contains(prefixed.String(), want) {
+			t.Errorf("Exec() prefixed output = %q, missing %q", prefixed.String(), want)
+		}
+	}
+}
+
+func TestRunMany(t *testing.T) {
+	tasks := []Task{
+		{Name: "first", Cmd: ShellCommand("echo first")},
+		{Name: "fails", Cmd: ShellCommand("exit 2")},
+		{Name: "third", Cmd: ShellCommand("echo third")},
+	}
+
+	results, err := RunMany(context.Background(), tasks, &RunManyOptions{Concurrency: 2})
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 2 {
+		t.Fatalf("RunMany() error = %v, want exit code 2", err)
+	}
+	if len(results) != 3 || string(results[2].Stdout) != "third\n" || len(results.Failed()) != 1 {
+		t.Errorf("RunMany() results = %+v", results)
+	}
+	summary := results.Summary()
+	for _, want := range []string{"TASK", "first", "fails", "third"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("Summary() = %q, missing %q", summary, want)
+		}
+	}
+
+	failFast := []Task{
+		{Name: "fails", Cmd: ShellCommand("exit 1")},
+		{Name: "slow", Cmd: ShellCommand("sleep 5")},
+		{Name: "skipped", Cmd: ShellCommand("echo skipped")},
+	}
+	start := time.Now()
+	results, err = RunMany(context.Background(), failFast, &RunManyOptions{Concurrency: 2, FailFast: true})
+	if err == nil || !results[2].Skipped || results[2].Result != nil {
+		t.Errorf("RunMany() fail fast results = %+v, error = %v", results, err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("RunMany() fail fast took %v", elapsed)
+	}
+	// the task stopped because "fails" failed is cancelled, not failed
+	if !results[1].Cancelled || len(results.Failed()) != 1 || strings.Contains(err.Error(), "slow") {
+		t.Errorf("RunMany() fail fast results = %+v, error = %v", results[1], err)
+	}
+	if summary := results.Summary(); !strings.Contains(summary, "cancelled") || strings.Count(summary, "failed") != 1 {
+		t.Errorf("Summary() = %q", summary)
+	}
+
+	if _, err := RunMany(context.Background(), []Task{{Name: "empty"}}, nil); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("RunMany() with a nil Cmd error = %v", err)
+	}
+}
+
+func TestPrintRunning(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	printRunning(&RunCmdOptions{Prefix: "[api] ", Redact: &Redactor{Literals: []string{"s3cr3t"}}}, "running script", "login s3cr3t")
+	os.Stdout = stdout
+	w.Close()
+
+	got, _ := io.ReadAll(r)
+	if string(got) != "[api] running script: login *****\n" {
+		t.Errorf("printRunning() = %q", got)
+	}
+}
+
+func TestExecRetry(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "attempts")
+	// fails twice with a retryable error, then succeeds
+	script := "echo x >> " + Quote(counter) + "; [ $(wc -l < " + Quote(counter) + ") -ge 3 ] || { echo 'connection reset' >&2; exit 7; }; echo done"
+
+	policy := &RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: time.Millisecond,
+		RetryOnStderr:  regexp.MustCompile("connection reset"),
+	}
+	res, err := Exec(context.Background(), ShellCommand(script), &RunCmdOptions{Retry: policy})
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if len(res.Attempts) != 3 || res.Attempts[0].ExitCode != 7 || res.Attempts[2].Err != nil {
+		t.Errorf("Exec() attempts = %+v", res.Attempts)
+	}
+
+	policy = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, RetryOnExitCodes: []int{7}}
+	res, err = Exec(context.Background(), ShellCommand("exit 1"), &RunCmdOptions{Retry: policy})
+	if err == nil || len(res.Attempts) != 1 {
+		t.Errorf("Exec() should not retry exit code 1, attempts = %+v", res.Attempts)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := policy.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		if got := policy.backoff(1); got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Errorf("backoff(1) with jitter = %v", got)
+		}
+	}
+}
+
+func TestExecDryRunAndRecorder(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "marker")
+	recorder := NewRecorder()
+
+	res, err := Exec(context.Background(), Command("touch", marker), &RunCmdOptions{DryRun: true, Recorder: recorder, Env: []string{"TERMINAL_TEST_DRY=1"}})
+	if err != nil || !res.DryRun {
+		t.Fatalf("Exec() dry run = %+v, error = %v", res, err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("Exec() dry run executed the command")
+	}
+
+	SetRecorder(recorder)
+	defer SetRecorder(nil)
+	RunCommand("exit 5", nil)
+
+	records := recorder.Records()
+	if len(records) != 2 {
+		t.Fatalf("Records() = %+v, want 2 records", records)
+	}
+	if !records[0].DryRun || records[0].Env[0] != "TERMINAL_TEST_DRY=<set>" || records[0].Command != "touch "+Quote(marker) {
+		t.Errorf("Records()[0] = %+v", records[0])
+	}
+	if records[1].ExitCode != 5 || records[1].Error == "" {
+		t.Errorf("Records()[1] = %+v", records[1])
+	}
+
+	out := bytes.Buffer{}
+	if err := recorder.WriteJSON(&out); err != nil || !strings.Contains(out.String(), `"exit_code": 5`) {
+		t.Errorf("WriteJSON() = %s, error = %v", out.String(), err)
+	}
+}
+
+func TestBuildEnv(t *testing.T) {
+	t.Setenv("TERMINAL_TEST_KEEP", "keep")
+	t.Setenv("TERMINAL_TEST_SECRET", "secret")
+	t.Setenv("TERMINAL_AWS_REGION", "us-east-1")
+
+	tests := []struct {
+		name string
+		opt  *RunCmdOptions
+		want []string
+	}{
+		{
+			name: "clean_env_with_duplicates",
+			opt:  &RunCmdOptions{CleanEnv: true, Env: []string{"A=1", "B=2", "A=3"}},
+			want: []string{"A=3", "B=2"},
+		},
+		{
+			name: "inherit_whitelist_and_unset",
+			opt: &RunCmdOptions{
+				InheritEnv: []string{"TERMINAL_TEST_KEEP", "TERMINAL_TEST_SECRET", "TERMINAL_AWS_*"},
+				UnsetEnv:   []string{"TERMINAL_TEST_SECRET"},
+				Env:        []string{"TERMINAL_TEST_KEEP=override"},
+			},
+			want: []string{"TERMINAL_TEST_KEEP=override", "TERMINAL_AWS_REGION=us-east-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildEnv(tt.opt)
+			sort.Strings(got)
+			sort.Strings(tt.want)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("buildEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	got := buildEnv(&RunCmdOptions{Env: []string{"TERMINAL_TEST_KEEP=new"}, UnsetEnv: []string{"TERMINAL_TEST_SECRET"}})
+	env := strings.Join(got, "\n")
+	if strings.Contains(env, "TERMINAL_TEST_SECRET") || strings.Count(env, "TERMINAL_TEST_KEEP=") != 1 || !strings.Contains(env, "TERMINAL_TEST_KEEP=new") {
+		t.Errorf("buildEnv() = %q", got)
+	}
+}
+
+func TestEnvForDisplay(t *testing.T) {
+	entries := []string{"(clean environment)", "+API_TOKEN=s3cr3t", "~HOME=/tmp", "-EDITOR"}
+
+	got := envForDisplay(&RunCmdOptions{}, entries)
+	want := []string{"(clean environment)", "+API_TOKEN=<set>", "~HOME=<set>", "-EDITOR"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("envForDisplay() = %q, want %q", got, want)
+	}
+	if got := envForDisplay(&RunCmdOptions{ShowEnvValues: true}, entries); strings.Join(got, ",") != strings.Join(entries, ",") {
+		t.Errorf("envForDisplay() with ShowEnvValues = %q, want %q", got, entries)
+	}
+}
+
+func TestExecStdin(t *testing.T) {
+	manifest := "kind: ConfigMap\nname: test\n"
+
+	res, err := Exec(context.Background(), Command("cat"), &RunCmdOptions{Input: []byte(manifest)})
+	if err != nil || string(res.Stdout) != manifest {
+		t.Errorf("Exec() with Input = %q, error = %v", res.Stdout, err)
+	}
+
+	res, err = Exec(context.Background(), Command("wc", "-l"), &RunCmdOptions{Stdin: strings.NewReader(manifest)})
+	if err != nil || strings.TrimSpace(string(res.Stdout)) != "2" {
+		t.Errorf("Exec() with Stdin = %q, error = %v", res.Stdout, err)
+	}
+
+	// Input is replayed for every retry attempt
+	policy := &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	res, err = Exec(context.Background(), ShellCommand("cat; exit 1"), &RunCmdOptions{Input: []byte("again"), Retry: policy})
+	if err == nil || len(res.Attempts) != 2 || string(res.Stdout) != "again" {
+		t.Errorf("Exec() retried with Input = %q, attempts = %d", res.Stdout, len(res.Attempts))
+	}
+}
+
+func TestRunPipeline(t *testing.T) {
+	res, err := RunPipeline(context.Background(), []*Cmd{
+		Command("printf", "api-1\nweb-1\napi-2\n"),
+		Command("grep", "api"),
+		Command("wc", "-l"),
+	}, nil)
+	if err != nil {
+		t.Fatalf("RunPipeline() error = %v", err)
+	}
+	if strings.TrimSpace(string(res.Stdout)) != "2" || len(res.Stages) != 3 || res.Command != `printf 'api-1
+web-1
+api-2
+' | grep api | wc -l` {
+		t.Errorf("RunPipeline() = %+v", res.Result)
+	}
+
+	// pipefail: the rightmost failing stage decides the exit code
+	res, err = RunPipeline(context.Background(), []*Cmd{
+		ShellCommand("echo first >&2; exit 3"),
+		ShellCommand("exit 4"),
+		Command("cat"),
+	}, nil)
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 4 {
+		t.Fatalf("RunPipeline() error = %v, want exit code 4", err)
+	}
+	if res.Stages[0].ExitCode != 3 || res.Stages[2].ExitCode != 0 || string(res.Stderr) != "first\n" {
+		t.Errorf("RunPipeline() stages = %+v %+v %+v", res.Stages[0], res.Stages[1], res.Stages[2])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	res, err = RunPipeline(ctx, []*Cmd{Command("sleep", "10"), Command("sleep", "10")}, nil)
+	if err == nil || !res.TimedOut || time.Since(start) > 2*time.Second {
+		t.Errorf("RunPipeline() cancel = %+v, error = %v", res.Result, err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	proc, err := Start(context.Background(), ShellCommand("echo starting; sleep 0.2; echo listening on 8080 >&2; sleep 10"), nil)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer proc.Stop(0)
+
+	if proc.PID() <= 0 {
+		t.Errorf("PID() = %d", proc.PID())
+	}
+	err = proc.WaitReady(context.Background(), &ReadinessProbe{LogLine: regexp.MustCompile(`listening on \d+`), Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("WaitReady() error = %v", err)
+	}
+	if string(proc.Stdout()) != "starting\n" || string(proc.Stderr()) != "listening on 8080\n" {
+		t.Errorf("output = %q, %q", proc.Stdout(), proc.Stderr())
+	}
+
+	start := time.Now()
+	if err := proc.Stop(time.Second); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	// the shell's sleep holds the output pipes, Wait only returns once the whole group is gone
+	res, err := proc.Wait()
+	if err == nil || res.Signal != syscall.SIGTERM || time.Since(start) > 2*time.Second {
+		t.Errorf("Wait() = %+v, %v", res, err)
+	}
+	if err := proc.Signal(syscall.SIGTERM); !errors.Is(err, os.ErrProcessDone) {
+		t.Errorf("Signal() after exit error = %v", err)
+	}
+}
+
+func TestStartWaitReady(t *testing.T) {
+	proc, err := Start(context.Background(), Command("sh", "-c", "exit 3"), nil)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	err = proc.WaitReady(context.Background(), &ReadinessProbe{LogLine: regexp.MustCompile("ready")})
+	if err == nil || !strings.Contains(err.Error(), "exited before becoming ready") {
+		t.Errorf("WaitReady() error = %v, want exited before ready", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	proc, err = Start(context.Background(), Command("sleep", "10"), nil)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	err = proc.WaitReady(context.Background(), &ReadinessProbe{TCPAddr: listener.Addr().String(), Timeout: time.Second})
+	if err != nil {
+		t.Errorf("WaitReady() tcp error = %v", err)
+	}
+
+	err = proc.WaitReady(context.Background(), &ReadinessProbe{LogLine: regexp.MustCompile("never"), Timeout: 100 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "not ready after") {
+		t.Errorf("WaitReady() error = %v, want timeout", err)
+	}
+
+	if err := StopAll(time.Second); err != nil {
+		t.Fatalf("StopAll() error = %v", err)
+	}
+	select {
+	case <-proc.Done():
+	default:
+		t.Error("StopAll() left the process running")
+	}
+
+	proc, err = Start(context.Background(), Command("sleep", "10"), &RunCmdOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Start() dry-run error = %v", err)
+	}
+	err = proc.WaitReady(context.Background(), &ReadinessProbe{LogLine: regexp.MustCompile("ready"), TCPAddr: "127.0.0.1:1"})
+	if err != nil {
+		t.Errorf("WaitReady() dry-run error = %v", err)
+	}
+}
+
+func TestStartCaptureLimit(t *testing.T) {
+	// the ready line is split across writes and comes after the head is full
+	proc, err := Start(context.Background(), ShellCommand("seq 1000; printf 'rea'; sleep 0.1; echo dy; sleep 10"), &RunCmdOptions{
+		CaptureLimit: &CaptureLimit{Head: 4, Tail: 6},
+	})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer proc.Stop(0)
+
+	err = proc.WaitReady(context.Background(), &ReadinessProbe{LogLine: regexp.MustCompile("^ready$"), Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("WaitReady() error = %v", err)
+	}
+	if want := "1\n2\n\n... [3889 bytes truncated] ...\nready\n"; string(proc.Stdout()) != want {
+		t.Errorf("Stdout() = %q, want %q", proc.Stdout(), want)
+	}
+
+	proc.Stop(0)
+	if res, _ := proc.Wait(); !res.Truncated {
+		t.Errorf("Wait() truncated = %v", res.Truncated)
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  CaptureLimit
+		writes []string
+		want   string
+	}{
+		{"under limit", CaptureLimit{Head: 4, Tail: 4}, []string{"abc", "de"}, "abcde"},
+		{"head and tail", CaptureLimit{Head: 2, Tail: 3}, []string{"abcd", "efgh", "ij"}, "ab\n... [5 bytes truncated] ...\nhij"},
+		{"tail only", CaptureLimit{Tail: 3}, []string{"abcdefgh"}, "\n... [5 bytes truncated] ...\nfgh"},
+		{"head only", CaptureLimit{Head: 3}, []string{"ab", "cdef"}, "abc\n... [3 bytes truncated] ...\n"},
+		{"wraps ring", CaptureLimit{Tail: 4}, []string{"abc", "def", "g", "hi"}, "\n... [5 bytes truncated] ...\nfghi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &limitedBuffer{limit: tt.limit}
+			for _, w := range tt.writes {
+				if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+			}
+			if got := string(b.Bytes()); got != tt.want {
+				t.Errorf("Bytes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptureLimit(t *testing.T) {
+	streamed := bytes.Buffer{}
+	res, err := Exec(context.Background(), Command("seq", "1000"), &RunCmdOptions{
+		Stdout:       &streamed,
+		CaptureLimit: &CaptureLimit{Head: 4, Tail: 9},
+	})
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if want := "1\n2\n\n... [3880 bytes truncated] ...\n999\n1000\n"; string(res.Stdout) != want || !res.Truncated {
+		t.Errorf("Exec() stdout = %q, truncated = %v, want %q", res.Stdout, res.Truncated, want)
+	}
+	if streamed.Len() != 3893 {
+		t.Errorf("streamed %d bytes, want all 3893", streamed.Len())
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	tests := []struct {
+		name string
+		r    *Redactor
+		in   string
+		want string
+	}{
+		{"nil", nil, "token s3cr3t", "token s3cr3t"},
+		{"literal", &Redactor{Literals: []string{"s3cr3t", ""}}, "a s3cr3t b s3cr3t", "a ***** b *****"},
+		{"pattern", &Redactor{Patterns: []*regexp.Regexp{regexp.MustCompile(`ghp_\w+`)}}, "token ghp_abc123!", "token *****!"},
+		{"groups", &Redactor{Patterns: []*regexp.Regexp{regexp.MustCompile(`(?:user|pass)=(\S+)`)}}, "user=bob pass=hunter2", "user=***** pass=*****"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.Redact(tt.in); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecRedact(t *testing.T) {
+	rec := NewRecorder()
+	streamed := bytes.Buffer{}
+	opt := &RunCmdOptions{
+		Env:           []string{"API_TOKEN=s3cr3t"},
+		Stdout:        &streamed,
+		Recorder:      rec,
+		Redact:        &Redactor{Literals: []string{"s3cr3t"}},
+		ShowEnvValues: true,
+	}
+
+	// the secret is written in two pieces to check it is found across writes
+	res, err := Exec(context.Background(), ShellCommand("printf s3c; printf 'r3t\\n'; echo token s3cr3t >&2; exit 1"), opt)
+	if err == nil {
+		t.Fatal("Exec() error = nil, want exit code 1")
+	}
+	for name, got := range map[string]string{
+		"command":  res.Command,
+		"stdout":   string(res.Stdout),
+		"stderr":   string(res.Stderr),
+		"streamed": streamed.String(),
+		"error":    err.Error(),
+		"env":      strings.Join(rec.Records()[0].Env, " "),
+	} {
+		if strings.Contains(got, "s3cr3t") || !strings.Contains(got, "*****") {
+			t.Errorf("%s = %q, want the secret masked", name, got)
+		}
+	}
+}
+
+func TestRunPipelineRedact(t *testing.T) {
+	streamed := bytes.Buffer{}
+	opt := &RunCmdOptions{
+		Stderr: &streamed,
+		Redact: &Redactor{Literals: []string{"s3cr3t"}},
+	}
+
+	// every stage writes to stderr at the same time
+	script := "for i in 1 2 3 4 5 6 7 8 9 10; do echo stage s3cr3t $i >&2; done"
+	res, err := RunPipeline(context.Background(), []*Cmd{
+		ShellCommand(script + "; echo out"),
+		ShellCommand(script + "; cat"),
+		ShellCommand(script + "; cat"),
+	}, opt)
+	if err != nil {
+		t.Fatalf("RunPipeline() error = %v", err)
+	}
+	if got := strings.Count(streamed.String(), "stage ***** "); got != 30 || strings.Contains(streamed.String(), "s3cr3t") {
+		t.Errorf("streamed stderr = %q, want 30 masked lines", streamed.String())
+	}
+	if strings.Contains(string(res.Stderr), "s3cr3t") || string(res.Stdout) != "out\n" {
+		t.Errorf("RunPipeline() = %+v", res.Result)
+	}
+}
+
+func TestOnInterrupt(t *testing.T) {
+	calls := []string{}
+	removeFirst := OnInterrupt(func() { calls = append(calls, "first") })
+	defer removeFirst()
+	removeSecond := OnInterrupt(func() { panic("broken hook") })
+	defer removeSecond()
+	removeThird := OnInterrupt(func() { calls = append(calls, "third") })
+	removeFourth := OnInterrupt(func() { calls = append(calls, "fourth") })
+	defer removeFourth()
+	removeThird()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Exec(context.Background(), ShellCommand("sleep 10"), nil)
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	cleanupInterrupted()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Exec() error = nil, want the interrupted command to fail")
+		}
+	case <-time.After(time.Second):
+		t.Error("cleanup left the child process running")
+	}
+	if strings.Join(calls, ",") != "fourth,first" {
+		t.Errorf("hooks ran as %v, want [fourth first]", calls)
+	}
+	if code := exitCode(os.Interrupt); code != 130 {
+		t.Errorf("exitCode(SIGINT) = %d, want 130", code)
+	}
+	if code := exitCode(syscall.SIGTERM); code != 143 {
+		t.Errorf("exitCode(SIGTERM) = %d, want 143", code)
+	}
+}
+
+func TestRestoreOnSignal(t *testing.T) {
+	interruptMu.Lock()
+	installed, hooks := interruptInstalled, len(interruptHooks)
+	interruptMu.Unlock()
+
+	restored := 0
+	stop := restoreOnSignal(func() { restored++ })
+	// the restore also runs when the OnInterrupt handler cleans up
+	cleanupInterrupted()
+	stop()
+	if restored != 1 {
+		t.Errorf("restore ran %d times, want 1", restored)
+	}
+
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+	if interruptInstalled != installed || len(interruptHooks) != hooks {
+		t.Errorf("restoreOnSignal() left installed = %v, %d hooks, want %v, %d", interruptInstalled, len(interruptHooks), installed, hooks)
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	tests := []struct {
+		version    string
+		constraint string
+		want       bool
+	}{
+		{"1.29.2", ">=1.28", true},
+		{"1.27.9", ">=1.28", false},
+		{"3.14.0", ">=3.0 <4", true},
+		{"4.0.0", ">=3.0, <4", false},
+		{"3.14.0", ">= 3.12", true},
+		{"2.5.0", "^2.1", true},
+		{"3.0.0", "^2.1", false},
+		{"0.2.9", "^0.2.3", true},
+		{"0.3.0", "^0.2.3", false},
+		{"1.2.9", "~1.2", true},
+		{"1.3.0", "~1.2", false},
+		{"1.2.0-rc.1", ">=1.2.0", false},
+		{"1.2.0", "=1.2", true},
+		{"1.2.0", "!=1.2.0", false},
+		{"2.0.0", "<1 || >=2", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version+" "+tt.constraint, func(t *testing.T) {
+			v, err := parseVersion(tt.version)
+			if err != nil {
+				t.Fatalf("parseVersion() error = %v", err)
+			}
+			got, err := satisfies(v, tt.constraint)
+			if err != nil || got != tt.want {
+				t.Errorf("satisfies() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := satisfies(version{}, ">=banana"); err == nil {
+		t.Error("satisfies() with an invalid constraint error = nil")
+	}
+}
+
+func TestRequire(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'faketool version v1.4.2 (build 99)'\n"
+	if err := os.WriteFile(filepath.Join(dir, "faketool"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	if path, err := Which("faketool"); err != nil || path != filepath.Join(dir, "faketool") {
+		t.Errorf("Which() = %q, %v", path, err)
+	}
+	if err := Require(context.Background(), Requirement{Name: "faketool", Version: "^1.3"}, Requirement{Name: "sh"}); err != nil {
+		t.Errorf("Require() error = %v", err)
+	}
+
+	err := Require(context.Background(),
+		Requirement{Name: "faketool", Version: ">=2", InstallHint: "brew upgrade faketool"},
+		Requirement{Name: "no-such-tool-here", InstallHint: "https://example.com/install"},
+		Requirement{Name: "sh"},
+	)
+	var reqErr *RequirementsError
+	if !errors.As(err, &reqErr) || len(reqErr.Unmet) != 2 {
+		t.Fatalf("Require() error = %v, want 2 unmet requirements", err)
+	}
+	want := `missing prerequisites:
+  faketool: version 1.4.2 does not satisfy >=2
+    install: brew upgrade faketool
+  no-such-tool-here: not found in PATH
+    install: https://example.com/install
+`
+	if err.Error() != want {
+		t.Errorf("Require() error = %q, want %q", err.Error(), want)
+	}
+
+	// the version probe runs for real and stays out of recordings
+	rec := NewRecorder()
+	SetRecorder(rec)
+	defer SetRecorder(nil)
+	SetDryRun(true)
+	defer SetDryRun(false)
+	if err := Require(context.Background(), Requirement{Name: "faketool", Version: "^1.3"}); err != nil {
+		t.Errorf("Require() in dry-run error = %v", err)
+	}
+	if len(rec.Records()) != 0 {
+		t.Errorf("Require() recorded %+v", rec.Records())
+	}
+}
+
+func TestShellScripts(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     *Cmd
+		opt     *RunCmdOptions
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "positional args",
+			cmd:  &Cmd{Script: `printf '%s|' "$1" "$2" "$#"`, ScriptArgs: []string{"a b", "$HOME"}},
+			want: "a b|$HOME|2|",
+		},
+		{
+			name: "bash",
+			cmd:  &Cmd{Shell: "bash", Script: `arr=(x y z); echo "${arr[1]}"`},
+			want: "y\n",
+		},
+		{
+			name: "shell from options",
+			cmd:  ShellCommand(`[[ -n "$BASH_VERSION" ]] && echo bash`),
+			opt:  &RunCmdOptions{Shell: "bash"},
+			want: "bash\n",
+		},
+		{
+			name: "in file",
+			cmd: &Cmd{Shell: "bash", InFile: true, ScriptArgs: []string{"world"}, Script: `cat <<EOF
+hello $1
+EOF`},
+			want: "hello world\n",
+		},
+		{
+			name:    "strict stops at the first failure",
+			cmd:     &Cmd{Strict: true, Script: "false\necho unreachable"},
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name:    "strict pipefail",
+			cmd:     &Cmd{Shell: "bash", Strict: true, Script: "false | cat\necho unreachable"},
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name: "not strict",
+			cmd:  &Cmd{Script: "false\necho reached"},
+			want: "reached\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RunCmd(context.Background(), tt.cmd, tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunCmd() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("RunCmd() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInFileScriptRemoved(t *testing.T) {
+	out, err := RunCmd(context.Background(), &Cmd{InFile: true, Script: `echo "$0"`}, nil)
+	if err != nil {
+		t.Fatalf("RunCmd() error = %v", err)
+	}
+	path := strings.TrimSpace(string(out))
+	if !strings.HasPrefix(filepath.Base(path), "script-") {
+		t.Fatalf("script ran as %q, want a temporary file", path)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("script file %s left behind, stat error = %v", path, err)
+	}
+
+	c := &Cmd{Shell: "bash", Script: "echo $1", ScriptArgs: []string{"it's"}}
+	if got := c.String(); got != `bash -c 'echo $1' bash 'it'\''s'` {
+		t.Errorf("String() = %q", got)
+	}
+}
@@ -0,0 +1,281 @@
+// Package terminaltest provides a scripted terminal.Executor so code that runs
+// commands through the terminal package can be unit tested without spawning
+// processes.
+package terminaltest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mcsteele8/common-cli-utils/terminal"
+)
+
+// Response is the canned outcome of a faked command.
+type Response struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	// Err is returned as the *terminal.ExitError cause, defaults to "exit status N"
+	// for a non-zero ExitCode.
+	Err error
+	// Delay simulates a slow command, it ends early if the context is cancelled.
+	Delay time.Duration
+}
+
+// Rule matches commands against a pattern and replies with its responses in
+// order, repeating the last one once they run out.
+type Rule struct {
+	pattern   *regexp.Regexp
+	responses []Response
+	next      int
+}
+
+// Respond adds responses to the rule.
+func (r *Rule) Respond(responses ...Response) *Rule {
+	r.responses = append(r.responses, responses...)
+	return r
+}
+
+// Call is a command the fake was asked to run.
+type Call struct {
+	Command string
+	Cmd     *terminal.Cmd
+	Opt     terminal.RunCmdOptions
+	// Stdin is what the command would have read from RunCmdOptions.Input or Stdin.
+	Stdin   []byte
+	Matched bool
+}
+
+/*
+FakeExecutor is a terminal.Executor that matches commands, as rendered by
+terminal.Cmd.String, against regular expressions and returns canned results.
+Rules are checked in the order they were added. Unmatched commands fail with
+exit code 127. Every program is installed at /fake/bin/<name> for
+terminal.Which and terminal.Require unless it is marked Missing.
+
+Example:
+
+	fake := terminaltest.NewFakeExecutor()
+	fake.Install(t)
+	fake.On(`^kubectl get pods`).Respond(terminaltest.Response{Stdout: "pod-1\n"})
+
+	out, _ := terminal.RunCommand("kubectl get pods -n default", nil)
+
+	fake.AssertCalled(t, `-n default`)
+*/
+type FakeExecutor struct {
+	mu      sync.Mutex
+	rules   []*Rule
+	calls   []Call
+	missing map[string]bool
+}
+
+func NewFakeExecutor() *FakeExecutor {
+	return &FakeExecutor{}
+}
+
+// On adds a rule for commands matching pattern. Without a Respond call the
+// command succeeds with no output.
+func (f *FakeExecutor) On(pattern string) *Rule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rule := &Rule{pattern: regexp.MustCompile(pattern)}
+	f.rules = append(f.rules, rule)
+	return rule
+}
+
+// Missing makes the programs names look uninstalled.
+func (f *FakeExecutor) Missing(names ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.missing == nil {
+		f.missing = map[string]bool{}
+	}
+	for _, name := range names {
+		f.missing[name] = true
+	}
+}
+
+// LookPath implements terminal.PathLooker.
+func (f *FakeExecutor) LookPath(name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.missing[name] {
+		return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+	}
+	return "/fake/bin/" + name, nil
+}
+
+// Install makes the fake the package-wide terminal executor until the test ends.
+func (f *FakeExecutor) Install(t testing.TB) {
+	t.Helper()
+
+	previous := terminal.SetExecutor(f)
+	t.Cleanup(func() {
+		terminal.SetExecutor(previous)
+	})
+}
+
+func (f *FakeExecutor) Execute(ctx context.Context, c *terminal.Cmd, opt *terminal.RunCmdOptions) (*terminal.Result, error) {
+	command := c.String()
+	resp, matched := f.match(command)
+
+	call := Call{Command: command, Cmd: c, Opt: *opt, Matched: matched}
+	switch {
+	case opt.Input != nil:
+		call.Stdin = opt.Input
+	case opt.Stdin != nil:
+		call.Stdin, _ = io.ReadAll(opt.Stdin)
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	f.mu.Unlock()
+
+	start := time.Now()
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(resp.Delay):
+		case <-ctx.Done():
+		}
+	}
+
+	res := &terminal.Result{
+		Command:  command,
+		ExitCode: resp.ExitCode,
+		Stdout:   []byte(resp.Stdout),
+		Stderr:   []byte(resp.Stderr),
+		Duration: time.Since(start),
+	}
+	stream(resp.Stdout, opt.Stdout, opt.OnStdoutLine)
+	stream(resp.Stderr, opt.Stderr, opt.OnStderrLine)
+
+	if ctx.Err() != nil {
+		res.ExitCode = -1
+		res.TimedOut = ctx.Err() == context.DeadlineExceeded
+		return res, &terminal.ExitError{Result: res, Err: ctx.Err()}
+	}
+
+	if resp.ExitCode == 0 && resp.Err == nil {
+		return res, nil
+	}
+
+	err := resp.Err
+	if err == nil {
+		err = fmt.Errorf("exit status %d", resp.ExitCode)
+	}
+	return res, &terminal.ExitError{Result: res, Err: err}
+}
+
+func (f *FakeExecutor) match(command string) (Response, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, rule := range f.rules {
+		if !rule.pattern.MatchString(command) {
+			continue
+		}
+		if len(rule.responses) == 0 {
+			return Response{}, true
+		}
+
+		resp := rule.responses[rule.next]
+		if rule.next < len(rule.responses)-1 {
+			rule.next++
+		}
+		return resp, true
+	}
+
+	return Response{
+		Stderr:   fmt.Sprintf("terminaltest: no fake response for command %q", command),
+		ExitCode: 127,
+	}, false
+}
+
+func stream(output string, w io.Writer, onLine func(string)) {
+	if output == "" {
+		return
+	}
+	if w != nil {
+		w.Write([]byte(output))
+	}
+	if onLine != nil {
+		for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+			onLine(line)
+		}
+	}
+}
+
+// Calls returns every command the fake was asked to run, in order.
+func (f *FakeExecutor) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call{}, f.calls...)
+}
+
+// CallCount returns how many calls matched pattern.
+func (f *FakeExecutor) CallCount(pattern string) int {
+	re := regexp.MustCompile(pattern)
+	count := 0
+	for _, call := range f.Calls() {
+		if re.MatchString(call.Command) {
+			count++
+		}
+	}
+	return count
+}
+
+// AssertCalled fails the test if no call matched pattern.
+func (f *FakeExecutor) AssertCalled(t testing.TB, pattern string) {
+	t.Helper()
+	if f.CallCount(pattern) == 0 {
+		t.Errorf("expected a command matching %q, got %s", pattern, f.commands())
+	}
+}
+
+// AssertNotCalled fails the test if any call matched pattern.
+func (f *FakeExecutor) AssertNotCalled(t testing.TB, pattern string) {
+	t.Helper()
+	if f.CallCount(pattern) > 0 {
+		t.Errorf("expected no command matching %q, got %s", pattern, f.commands())
+	}
+}
+
+// AssertCallCount fails the test unless exactly n calls matched pattern.
+func (f *FakeExecutor) AssertCallCount(t testing.TB, pattern string, n int) {
+	t.Helper()
+	if got := f.CallCount(pattern); got != n {
+		t.Errorf("expected %d commands matching %q, got %d: %s", n, pattern, got, f.commands())
+	}
+}
+
+// AssertAllMatched fails the test if any command had no matching rule.
+func (f *FakeExecutor) AssertAllMatched(t testing.TB) {
+	t.Helper()
+	for _, call := range f.Calls() {
+		if !call.Matched {
+			t.Errorf("unexpected command without a fake response: %s", call.Command)
+		}
+	}
+}
+
+func (f *FakeExecutor) commands() string {
+	commands := []string{}
+	for _, call := range f.Calls() {
+		commands = append(commands, call.Command)
+	}
+	if len(commands) == 0 {
+		return "no commands"
+	}
+	return "[" + strings.Join(commands, ", ") + "]"
+}
@@ -0,0 +1,92 @@
+package terminaltest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mcsteele8/common-cli-utils/terminal"
+)
+
+func TestFakeExecutor(t *testing.T) {
+	fake := NewFakeExecutor()
+	fake.Install(t)
+	fake.On(`^kubectl get pods`).Respond(Response{Stdout: "pod-1\npod-2\n"})
+	fake.On(`^helm repo update`).Respond(
+		Response{Stderr: "connection reset", ExitCode: 1},
+		Response{Stdout: "updated\n"},
+	)
+
+	lines := []string{}
+	out, err := terminal.RunCmd(context.Background(), terminal.Command("kubectl", "get", "pods", "-n", "default"), &terminal.RunCmdOptions{
+		OnStdoutLine: func(line string) { lines = append(lines, line) },
+	})
+	if err != nil || string(out) != "pod-1\npod-2\n" || len(lines) != 2 {
+		t.Errorf("RunCmd() = %q, lines = %q, error = %v", out, lines, err)
+	}
+
+	res, err := terminal.Exec(context.Background(), terminal.ShellCommand("helm repo update"), &terminal.RunCmdOptions{
+		Retry: &terminal.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+	})
+	if err != nil || len(res.Attempts) != 2 || string(res.Stdout) != "updated\n" {
+		t.Errorf("Exec() = %+v, error = %v", res, err)
+	}
+
+	_, err = terminal.RunCommand("rm -rf /tmp/cache", nil)
+	var exitErr *terminal.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 127 {
+		t.Errorf("RunCommand() unmatched error = %v", err)
+	}
+
+	terminal.RunCmd(context.Background(), terminal.Command("kubectl", "apply", "-f", "-"), &terminal.RunCmdOptions{Input: []byte("kind: Pod\n")})
+
+	fake.AssertCalled(t, `-n default`)
+	fake.AssertCallCount(t, `^helm`, 2)
+	fake.AssertNotCalled(t, `^git`)
+	if calls := fake.Calls(); len(calls) != 5 || calls[3].Matched || string(calls[4].Stdin) != "kind: Pod\n" {
+		t.Errorf("Calls() = %+v", calls)
+	}
+}
+
+func TestRunSudoDryRun(t *testing.T) {
+	fake := NewFakeExecutor()
+	fake.Install(t)
+
+	res, err := terminal.RunSudo(context.Background(), terminal.Command("apt-get", "install", "-y", "jq"), &terminal.RunCmdOptions{DryRun: true})
+	if err != nil || !res.DryRun || res.Command != "sudo -- apt-get install -y jq" {
+		t.Errorf("RunSudo() = %+v, error = %v", res, err)
+	}
+	// neither the password probe nor the command reach the executor
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("Calls() = %+v", calls)
+	}
+}
+
+func TestFakeExecutorRequire(t *testing.T) {
+	fake := NewFakeExecutor()
+	fake.Install(t)
+	fake.On(`^kubectl version --client$`).Respond(Response{Stdout: "Client Version: v1.27.3\n"})
+	fake.Missing("helm")
+
+	// the version probe is not a change, it runs against the fake even in dry-run mode
+	terminal.SetDryRun(true)
+	defer terminal.SetDryRun(false)
+
+	results := terminal.Check(context.Background(),
+		terminal.Requirement{Name: "kubectl", Version: ">=1.28"},
+		terminal.Requirement{Name: "helm"},
+		terminal.Requirement{Name: "git"},
+	)
+	if results[0].Found != "1.27.3" || results[0].Err == nil {
+		t.Errorf("kubectl result = %+v", results[0])
+	}
+	if results[1].Err == nil || results[1].Path != "" {
+		t.Errorf("helm result = %+v", results[1])
+	}
+	if results[2].Err != nil || results[2].Path != "/fake/bin/git" {
+		t.Errorf("git result = %+v", results[2])
+	}
+	fake.AssertCallCount(t, `^kubectl version`, 1)
+	fake.AssertAllMatched(t)
+}